@@ -4,139 +4,391 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/macstadium/orka-github-actions-integration/pkg/admin"
 	"github.com/macstadium/orka-github-actions-integration/pkg/constants"
 	"github.com/macstadium/orka-github-actions-integration/pkg/env"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/actions"
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/rest"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/runners"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
+	"github.com/macstadium/orka-github-actions-integration/pkg/health"
+	retryablehttp "github.com/macstadium/orka-github-actions-integration/pkg/http"
 	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
 	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
 	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+	runnercache "github.com/macstadium/orka-github-actions-integration/pkg/runner-cache"
 	provisioner "github.com/macstadium/orka-github-actions-integration/pkg/runner-provisioner"
+	"github.com/macstadium/orka-github-actions-integration/pkg/state"
+	"github.com/macstadium/orka-github-actions-integration/pkg/tracing"
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+// shutdownCleanupTimeout bounds how long the process waits for canceled runners to de-register and delete their VMs.
+const shutdownCleanupTimeout = 5 * time.Minute
+
+// tracingShutdownTimeout bounds how long the process waits for the remaining spans to be exported on exit.
+const tracingShutdownTimeout = 10 * time.Second
+
+type scaleSet struct {
+	runner         env.Runner
+	groupId        int
+	runnerScaleSet *types.RunnerScaleSet
+	runnerManager  *runners.RunnerManager
+	provisioner    *provisioner.RunnerProvisioner
+	vmTracker      *runners.VMTracker
+	processor      *runners.RunnerMessageProcessor
+	logger         *zap.SugaredLogger
+
+	closeOnce sync.Once
+}
+
+func (s *scaleSet) close() {
+	s.closeOnce.Do(func() { s.runnerManager.Close() })
+}
+
 func main() {
 	envData := env.ParseEnv()
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// ctx outlives the termination signal, so that running jobs can finish and be cleaned up while the process drains.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// backgroundCtx stops the work that only adds VMs, such as the warm pool, as soon as draining starts.
+	backgroundCtx, stopBackground := context.WithCancel(ctx)
+	defer stopBackground()
+
 	logging.SetupLogger(envData.LogLevel)
 	logger := logging.Logger.Named("main")
 
+	if envData.EnableTracing {
+		shutdownTracing, err := tracing.Setup(ctx)
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+			defer cancelShutdown()
+
+			if err := shutdownTracing(shutdownCtx); err != nil {
+				logger.Warnf("unable to flush traces on exit: %v", err)
+			}
+		}()
+	}
+
 	config, err := github.NewGitHubConfig(envData.GitHubURL)
 	if err != nil {
 		panic(err)
 	}
 
-	runnerName := envData.Runners[0].Name
-	groupId := constants.DefaultRunnerGroupID
-	if envData.Runners[0].Id != 0 {
-		groupId = envData.Runners[0].Id
+	for _, runner := range envData.Runners {
+		if len(validation.IsValidLabelValue(runner.Name)) > 0 || len(validation.IsDNS1035Label(runner.Name)) > 0 {
+			panic(fmt.Sprintf("invalid runner name: %s. Runner name must consist of lower case alphanumeric characters or ' - ', start with an alphabetic character, end with an alphanumeric character, and may not be longer than 63 characters.", runner.Name))
+		}
 	}
 
-	if len(validation.IsValidLabelValue(runnerName)) > 0 || len(validation.IsDNS1035Label(runnerName)) > 0 {
-		panic(fmt.Sprintf("invalid runner name: %s. Runner name must consist of lower case alphanumeric characters or ' - ', start with an alphabetic character, end with an alphanumeric character, and may not be longer than 63 characters.", runnerName))
-	}
+	retryablehttp.SetRateLimit(envData.GitHubAPIRateLimit, envData.GitHubAPIRateLimitBurst)
 
 	actionsClient, err := actions.NewActionsClient(ctx, envData, config)
 	if err != nil {
 		panic(err)
 	}
 
+	orkaClient, err := orka.NewOrkaClient(envData, ctx)
+	if err != nil {
+		panic(fmt.Sprintf("unable to access Orka cluster. More info: %s", err.Error()))
+	}
+
+	stateStore, err := state.NewStore(envData.StateStorePath)
+	if err != nil {
+		panic(err)
+	}
+
+	var metricsServer *metrics.Metrics
+	if envData.EnableMetrics {
+		metricsServer = metrics.Start(ctx, logger, envData)
+	}
+
+	if envData.EnableRunnerCache {
+		// The cache stays up while the process drains, so that runners of jobs that are already assigned can still be set up.
+		go runnercache.NewServer(envData.RunnerCacheDir, envData.RunnerDownloadURL, envData.GitHubRunnerVersion, envData.RunnerSHA256Checksums, logger).Start(context.Background(), envData.RunnerCacheAddr)
+	}
+
+	capacityManagers := map[string]*provisioner.CapacityManager{}
+	if envData.OrkaCapacityCheck {
+		for _, namespace := range envData.Namespaces() {
+			capacityManagers[namespace] = provisioner.NewCapacityManager(orkaClient, namespace, envData.OrkaCapacityPollInterval)
+			go capacityManagers[namespace].Start(ctx)
+		}
+	}
+
+	globalLimiter := provisioner.NewRunnerLimiter(envData.RunnerSlots(), nil)
+
+	var restClient *rest.Client
+	for _, runner := range envData.Runners {
+		if runner.Group != "" {
+			if restClient, err = rest.NewClient(ctx, envData, config); err != nil {
+				panic(err)
+			}
+			break
+		}
+	}
+
+	scaleSets := make([]*scaleSet, 0, len(envData.Runners))
+	for _, runner := range envData.Runners {
+		groupId, err := resolveRunnerGroup(ctx, restClient, runner, logger)
+		if err != nil {
+			panic(err)
+		}
+
+		s, err := setupScaleSet(ctx, actionsClient, runner, groupId, envData, logger)
+		if err != nil {
+			panic(err)
+		}
+		s.provisioner = provisioner.NewRunnerProvisioner(s.runnerScaleSet, &s.runner, actionsClient, orkaClient, capacityManagers[runner.OrkaNamespace], provisioner.NewRunnerLimiter(runner.RunnerSlots(), globalLimiter), stateStore, envData)
+		s.vmTracker = runners.NewVMTracker(orkaClient, actionsClient, s.runner.OrkaNamespace, s.logger)
+		s.processor = runners.NewRunnerMessageProcessor(ctx, s.runnerManager, s.provisioner, s.vmTracker, s.runnerScaleSet, s.runner.MinRunners)
+		scaleSets = append(scaleSets, s)
+
+		if metricsServer != nil {
+			metricsServer.StartPoller(ctx, logger, envData.MetricsPollInterval, actionsClient, s.runner.Name, s.groupId)
+		}
+	}
+
+	if envData.EnableAdminAPI {
+		adminScaleSets := make([]admin.ScaleSet, 0, len(scaleSets))
+		for _, s := range scaleSets {
+			adminScaleSets = append(adminScaleSets, s.processor)
+		}
+		go admin.NewServer(adminScaleSets, stateStore, envData.AdminAPIToken, logger).Start(ctx, envData.AdminAPIAddr)
+	}
+
+	if envData.EnableHealthProbes {
+		// The probes stay up while the process drains, so that the orchestrator does not restart it halfway through.
+		go newHealthServer(signalCtx, actionsClient, orkaClient, scaleSets, envData, logger).Start(context.Background(), envData.HealthProbesAddr)
+	}
+
+	defer func() {
+		for _, s := range scaleSets {
+			s.close()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, s := range scaleSets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(ctx, backgroundCtx, actionsClient, orkaClient, s, envData)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-signalCtx.Done():
+		// A second signal terminates the process right away.
+		stop()
+		logger.Infof("received termination signal, draining runners for up to %v", envData.DrainTimeout)
+
+		stopBackground()
+		drain(scaleSets, cancel, envData.DrainTimeout, logger)
+		<-done
+
+		for _, s := range scaleSets {
+			s.close()
+
+			if envData.ManageRunnerScaleSets {
+				if err := actionsClient.DeleteRunnerScaleSet(context.TODO(), s.runnerScaleSet.Id); err != nil {
+					logger.Errorf("error deleting runner scale set %s on exit: %s", s.runnerScaleSet.Name, err.Error())
+				}
+			}
+
+			s.provisioner.Close(context.TODO())
+		}
+
+		logger.Info("shutdown completed")
+	}
+}
+
+// drain stops acquiring jobs and waits up to timeout for the running jobs to finish. Runners that are still active
+// afterwards are canceled through cancelProcessing, which de-registers them and deletes their VMs.
+func drain(scaleSets []*scaleSet, cancelProcessing context.CancelFunc, timeout time.Duration, logger *zap.SugaredLogger) {
+	for _, s := range scaleSets {
+		s.processor.Drain()
+	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), timeout)
+	defer cancelDrain()
+
+	if err := waitForRunners(drainCtx, scaleSets); err != nil {
+		logger.Warnf("drain timeout of %v reached, canceling %d active runners", timeout, activeRunners(scaleSets))
+	}
+
+	cancelProcessing()
+
+	cleanupCtx, cancelCleanup := context.WithTimeout(context.Background(), shutdownCleanupTimeout)
+	defer cancelCleanup()
+
+	if err := waitForRunners(cleanupCtx, scaleSets); err != nil {
+		logger.Errorf("%d runners were not cleaned up within %v, their VMs are left to the orphan sweep", activeRunners(scaleSets), shutdownCleanupTimeout)
+	}
+}
+
+func waitForRunners(ctx context.Context, scaleSets []*scaleSet) error {
+	for _, s := range scaleSets {
+		if err := s.processor.WaitForRunners(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func activeRunners(scaleSets []*scaleSet) int {
+	active := 0
+	for _, s := range scaleSets {
+		active += s.processor.ActiveRunners()
+	}
+
+	return active
+}
+
+// newHealthServer reports the process as alive while the message loops make progress and the GitHub token can be
+// refreshed, and as ready while every scale set has a message session and Orka is reachable. Once signalCtx is done,
+// the message loops are no longer checked, because they stop while the process drains.
+func newHealthServer(signalCtx context.Context, actionsClient *actions.ActionsClient, orkaClient orka.OrkaService, scaleSets []*scaleSet, envData *env.Data, logger *zap.SugaredLogger) *health.Server {
+	healthServer := health.NewServer(logger)
+
+	healthServer.AddLivenessCheck("github-token", func(ctx context.Context) error {
+		return actionsClient.CheckToken()
+	})
+
+	for _, s := range scaleSets {
+		healthServer.AddLivenessCheck("message-loop-"+s.runner.Name, func(ctx context.Context) error {
+			if signalCtx.Err() != nil {
+				return nil
+			}
+			return s.processor.CheckMessageLoop(envData.HealthMessageLoopTimeout)
+		})
+		healthServer.AddReadinessCheck("message-session-"+s.runner.Name, func(ctx context.Context) error {
+			return s.processor.CheckSession()
+		})
+	}
+
+	for _, namespace := range envData.Namespaces() {
+		healthServer.AddReadinessCheck("orka-"+namespace, func(ctx context.Context) error {
+			if _, err := orkaClient.ListNodes(ctx, namespace); err != nil {
+				return fmt.Errorf("unable to reach Orka: %w", err)
+			}
+			return nil
+		})
+	}
+
+	return healthServer
+}
+
+// resolveRunnerGroup returns the id of the runner group of the runner. A group name is looked up through the GitHub
+// API and the group is created if the runner allows it.
+func resolveRunnerGroup(ctx context.Context, restClient *rest.Client, runner env.Runner, logger *zap.SugaredLogger) (int, error) {
+	if runner.Group == "" {
+		if runner.Id != 0 {
+			return runner.Id, nil
+		}
+		return constants.DefaultRunnerGroupID, nil
+	}
+
+	group, err := restClient.GetRunnerGroup(ctx, runner.Group)
+	if err != nil {
+		return 0, fmt.Errorf("error looking up runner group %s of runner %s: %w", runner.Group, runner.Name, err)
+	}
+
+	if group == nil {
+		if runner.CreateGroup == nil {
+			return 0, fmt.Errorf("runner group %s of runner %s does not exist", runner.Group, runner.Name)
+		}
+
+		group, err = restClient.CreateRunnerGroup(ctx, runner.Group, runner.CreateGroup.Visibility, runner.CreateGroup.Repositories)
+		if err != nil {
+			return 0, err
+		}
+		logger.Infof("created runner group %s (id=%d) for runner %s", group.Name, group.Id, runner.Name)
+	}
+
+	return group.Id, nil
+}
+
+func setupScaleSet(ctx context.Context, actionsClient *actions.ActionsClient, runner env.Runner, groupId int, envData *env.Data, logger *zap.SugaredLogger) (*scaleSet, error) {
+	runnerName := runner.Name
+
 	existing, err := actionsClient.GetRunnerScaleSet(ctx, groupId, runnerName)
 	if err != nil {
-		panic(fmt.Sprintf("error checking for existing runner scale set: %s", err.Error()))
+		return nil, fmt.Errorf("error checking for existing runner scale set %s: %s", runnerName, err.Error())
 	}
 
 	var runnerScaleSet *types.RunnerScaleSet
 	if existing != nil && !envData.ManageRunnerScaleSets {
 		logger.Infof("reusing existing runner scale set %s (id=%d)", existing.Name, existing.Id)
-		runnerScaleSet = existing
+		runnerScaleSet = reconcileLabels(ctx, actionsClient, existing, runner.ScaleSetLabels(), logger)
 	} else {
 		if existing != nil {
 			if err = actionsClient.DeleteRunnerScaleSet(ctx, existing.Id); err != nil {
-				panic(fmt.Sprintf("error deleting existing runner scale set: %s", err.Error()))
+				return nil, fmt.Errorf("error deleting existing runner scale set %s: %s", runnerName, err.Error())
 			}
 		}
-		runnerScaleSet, err = createScaleSet(ctx, actionsClient, runnerName, groupId)
+		runnerScaleSet, err = createScaleSet(ctx, actionsClient, runnerName, runner.ScaleSetLabels(), groupId)
 		if err != nil {
-			panic(fmt.Sprintf("unable to create runner %s, err: %s", runnerName, err.Error()))
+			return nil, fmt.Errorf("unable to create runner %s, err: %s", runnerName, err.Error())
 		}
 		logger.Infof("created runner scale set %s (id=%d)", runnerScaleSet.Name, runnerScaleSet.Id)
 	}
 
-	if envData.EnableMetrics {
-		metrics.Start(ctx, logger, envData, actionsClient, runnerName, groupId)
-	}
-
-	orkaClient, err := orka.NewOrkaClient(envData, ctx)
-	if err != nil {
-		panic(fmt.Sprintf("unable to access Orka cluster. More info: %s", err.Error()))
-	}
-
 	runnerManager, err := runners.NewRunnerManager(ctx, actionsClient, runnerScaleSet.Id)
 	if errors.Is(err, runners.ErrActiveSession) {
 		logger.Infof("scale set %s (id=%d) has a stale active session, deleting and recreating", runnerScaleSet.Name, runnerScaleSet.Id)
 		if err = actionsClient.DeleteRunnerScaleSet(ctx, runnerScaleSet.Id); err != nil {
-			panic(fmt.Sprintf("error deleting scale set with active session: %s", err.Error()))
+			return nil, fmt.Errorf("error deleting scale set %s with active session: %s", runnerName, err.Error())
 		}
-		runnerScaleSet, err = createScaleSet(ctx, actionsClient, runnerName, groupId)
+		runnerScaleSet, err = createScaleSet(ctx, actionsClient, runnerName, runner.ScaleSetLabels(), groupId)
 		if err != nil {
-			panic(fmt.Sprintf("error recreating scale set after active session conflict: %s", err.Error()))
+			return nil, fmt.Errorf("error recreating scale set %s after active session conflict: %s", runnerName, err.Error())
 		}
 		logger.Infof("recreated scale set %s (id=%d)", runnerScaleSet.Name, runnerScaleSet.Id)
 		runnerManager, err = runners.NewRunnerManager(ctx, actionsClient, runnerScaleSet.Id)
 	}
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	var closeOnce sync.Once
-	closeManager := func() {
-		closeOnce.Do(func() { runnerManager.Close() })
-	}
-	defer closeManager()
-
-	go func() {
-		<-ctx.Done()
-
-		if ctx.Err() == context.Canceled {
-			logger.Info("received termination signal, performing cleanup")
-
-			closeManager()
-
-			if envData.ManageRunnerScaleSets {
-				if err := actionsClient.DeleteRunnerScaleSet(context.TODO(), runnerScaleSet.Id); err != nil {
-					logger.Errorf("error deleting runner scale set on exit: %s", err.Error())
-				}
-			}
-
-			os.Exit(0)
-		}
-	}()
-
-	run(ctx, actionsClient, orkaClient, runnerScaleSet, runnerManager, envData, logger)
+	return &scaleSet{
+		runner:         runner,
+		groupId:        groupId,
+		runnerScaleSet: runnerScaleSet,
+		runnerManager:  runnerManager,
+		logger:         logger.Named(runnerName),
+	}, nil
 }
 
-func createScaleSet(ctx context.Context, actionsClient *actions.ActionsClient, runnerName string, groupId int) (*types.RunnerScaleSet, error) {
+func createScaleSet(ctx context.Context, actionsClient *actions.ActionsClient, runnerName string, labels []string, groupId int) (*types.RunnerScaleSet, error) {
 	return actionsClient.CreateRunnerScaleSet(ctx, &types.RunnerScaleSet{
 		Name:          runnerName,
 		RunnerGroupId: groupId,
-		Labels: []types.RunnerScaleSetLabel{
-			{
-				Name: runnerName,
-				Type: "System",
-			},
-		},
+		Labels:        scaleSetLabels(labels),
 		RunnerSetting: types.RunnerScaleSetSetting{
 			Ephemeral:     true,
 			DisableUpdate: true,
@@ -144,15 +396,72 @@ func createScaleSet(ctx context.Context, actionsClient *actions.ActionsClient, r
 	})
 }
 
-func run(ctx context.Context, actionsClient *actions.ActionsClient, orkaClient *orka.OrkaClient, runnerScaleSet *types.RunnerScaleSet, runnerManager *runners.RunnerManager, envData *env.Data, logger *zap.SugaredLogger) {
-	runnerProvisioner := provisioner.NewRunnerProvisioner(runnerScaleSet, actionsClient, orkaClient, envData)
+func scaleSetLabels(labels []string) []types.RunnerScaleSetLabel {
+	scaleSetLabels := make([]types.RunnerScaleSetLabel, 0, len(labels))
+	for _, label := range labels {
+		scaleSetLabels = append(scaleSetLabels, types.RunnerScaleSetLabel{
+			Name: label,
+			Type: "System",
+		})
+	}
+
+	return scaleSetLabels
+}
+
+// reconcileLabels updates the labels of a reused runner scale set when they differ from the configured ones. The scale
+// set is kept as is with a warning when the update fails.
+func reconcileLabels(ctx context.Context, actionsClient *actions.ActionsClient, existing *types.RunnerScaleSet, labels []string, logger *zap.SugaredLogger) *types.RunnerScaleSet {
+	current := map[string]bool{}
+	for _, label := range existing.Labels {
+		current[strings.ToLower(label.Name)] = true
+	}
+
+	drifted := len(current) != len(labels)
+	for _, label := range labels {
+		if !current[strings.ToLower(label)] {
+			drifted = true
+		}
+	}
+	if !drifted {
+		return existing
+	}
+
+	existingLabels := make([]string, 0, len(existing.Labels))
+	for _, label := range existing.Labels {
+		existingLabels = append(existingLabels, label.Name)
+	}
+	logger.Infof("updating the labels of runner scale set %s from %v to %v", existing.Name, existingLabels, labels)
+
+	updated, err := actionsClient.UpdateRunnerScaleSet(ctx, existing.Id, &types.RunnerScaleSet{
+		Name:          existing.Name,
+		RunnerGroupId: existing.RunnerGroupId,
+		Labels:        scaleSetLabels(labels),
+		RunnerSetting: existing.RunnerSetting,
+	})
+	if err != nil {
+		logger.Warnf("unable to update the labels of runner scale set %s, jobs that request %v may not be assigned to it: %v", existing.Name, labels, err)
+		return existing
+	}
+
+	return updated
+}
+
+func run(ctx, backgroundCtx context.Context, actionsClient *actions.ActionsClient, orkaClient orka.OrkaService, s *scaleSet, envData *env.Data) {
+	go s.vmTracker.Start(ctx, envData.VMTrackerInterval)
 
-	vmTracker := runners.NewVMTracker(orkaClient, actionsClient, logger)
-	go vmTracker.Start(ctx, envData.VMTrackerInterval)
+	if envData.OrphanSweepEnabled {
+		vmSweeper := runners.NewVMSweeper(orkaClient, actionsClient, s.runner.OrkaNamespace, envData.ControllerId, s.runnerScaleSet.Name, s.provisioner.IsManagedVM, envData.OrphanSweepGracePeriod, envData.OrphanSweepDryRun, s.logger)
+		go vmSweeper.Start(backgroundCtx, envData.OrphanSweepInterval)
+	}
+
+	for _, runnerName := range s.provisioner.RecoverRunners(ctx) {
+		s.processor.AdoptRunner(runnerName)
+	}
 
-	runnerMessageProcessor := runners.NewRunnerMessageProcessor(ctx, runnerManager, runnerProvisioner, vmTracker, runnerScaleSet)
+	// The warm pool records its VMs in the state store, so it only starts once the recorded VMs have been recovered
+	go s.provisioner.StartWarmPool(backgroundCtx)
 
-	if err := runnerMessageProcessor.StartProcessingMessages(); err != nil && !errors.Is(err, context.Canceled) {
-		logger.Errorf("failed to start processing messages for runnerScaleSet %s: %v", runnerScaleSet.Name, err)
+	if err := s.processor.StartProcessingMessages(); err != nil && !errors.Is(err, context.Canceled) {
+		s.logger.Errorf("failed to start processing messages for runnerScaleSet %s: %v", s.runnerScaleSet.Name, err)
 	}
 }
@@ -0,0 +1,266 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/state"
+	"go.uber.org/zap"
+)
+
+// ScaleSet is the part of a runner scale set's message processor that the admin API controls.
+type ScaleSet interface {
+	Name() string
+	Pause()
+	Resume()
+	Paused() bool
+	Drain()
+	Draining() bool
+	ActiveRunners() int
+	WaitForRunners(ctx context.Context) error
+	CancelRunner(runnerName string) bool
+}
+
+type Server struct {
+	scaleSets  []ScaleSet
+	stateStore state.Store
+	token      string
+	logger     *zap.SugaredLogger
+}
+
+type ScaleSetStatus struct {
+	Name          string `json:"name"`
+	Paused        bool   `json:"paused"`
+	Draining      bool   `json:"draining"`
+	ActiveRunners int    `json:"activeRunners"`
+}
+
+type JobStatus struct {
+	ScaleSet        string      `json:"scaleSet"`
+	JobId           string      `json:"jobId,omitempty"`
+	RunnerRequestId int64       `json:"runnerRequestId,omitempty"`
+	VMName          string      `json:"vmName"`
+	Namespace       string      `json:"namespace"`
+	IP              string      `json:"ip,omitempty"`
+	Phase           state.Phase `json:"phase"`
+	Age             string      `json:"age"`
+}
+
+type Status struct {
+	ScaleSets []ScaleSetStatus `json:"scaleSets"`
+	Jobs      []JobStatus      `json:"jobs"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewServer creates the admin API for the scale sets. Requests must carry the token as a bearer token when it is set.
+func NewServer(scaleSets []ScaleSet, stateStore state.Store, token string, logger *zap.SugaredLogger) *Server {
+	return &Server{
+		scaleSets:  scaleSets,
+		stateStore: stateStore,
+		token:      token,
+		logger:     logger.Named("admin"),
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("POST /drain", s.handleDrain)
+	mux.HandleFunc("POST /pause", s.handlePause)
+	mux.HandleFunc("POST /resume", s.handleResume)
+	mux.HandleFunc("DELETE /vms/{name}", s.handleDeleteVM)
+
+	return s.authenticate(mux)
+}
+
+func (s *Server) Start(ctx context.Context, addr string) {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: s.Handler(),
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	s.logger.Infof("admin API available at %s", addr)
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.logger.Errorf("admin API server failed: %v", err)
+	}
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "unauthorized"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := Status{
+		ScaleSets: []ScaleSetStatus{},
+		Jobs:      []JobStatus{},
+	}
+
+	scaleSets, ok := s.selectScaleSets(w, r)
+	if !ok {
+		return
+	}
+
+	names := map[string]bool{}
+	for _, scaleSet := range scaleSets {
+		names[scaleSet.Name()] = true
+		status.ScaleSets = append(status.ScaleSets, scaleSetStatus(scaleSet))
+	}
+
+	records, err := s.stateStore.List()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+
+	for _, record := range records {
+		if !names[record.ScaleSetName] {
+			continue
+		}
+
+		status.Jobs = append(status.Jobs, JobStatus{
+			ScaleSet:        record.ScaleSetName,
+			JobId:           record.JobId,
+			RunnerRequestId: record.RunnerRequestId,
+			VMName:          record.RunnerName,
+			Namespace:       record.Namespace,
+			IP:              record.IP,
+			Phase:           record.Phase,
+			Age:             time.Since(record.CreatedAt).Round(time.Second).String(),
+		})
+	}
+
+	sort.Slice(status.Jobs, func(i, j int) bool {
+		return status.Jobs[i].VMName < status.Jobs[j].VMName
+	})
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleDrain stops acquiring jobs. With ?wait=true the response is only sent once all runners have finished.
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	scaleSets, ok := s.selectScaleSets(w, r)
+	if !ok {
+		return
+	}
+
+	for _, scaleSet := range scaleSets {
+		s.logger.Infof("drain requested for %s", scaleSet.Name())
+		scaleSet.Drain()
+	}
+
+	if r.URL.Query().Get("wait") == "true" {
+		for _, scaleSet := range scaleSets {
+			if err := scaleSet.WaitForRunners(r.Context()); err != nil {
+				s.logger.Warnf("stopped waiting for the runners of %s to finish: %v", scaleSet.Name(), err)
+				writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "stopped waiting for the runners of " + scaleSet.Name() + " to finish: " + err.Error()})
+				return
+			}
+		}
+	}
+
+	writeScaleSets(w, http.StatusAccepted, scaleSets)
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	scaleSets, ok := s.selectScaleSets(w, r)
+	if !ok {
+		return
+	}
+
+	for _, scaleSet := range scaleSets {
+		s.logger.Infof("pause requested for %s", scaleSet.Name())
+		scaleSet.Pause()
+	}
+
+	writeScaleSets(w, http.StatusOK, scaleSets)
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	scaleSets, ok := s.selectScaleSets(w, r)
+	if !ok {
+		return
+	}
+
+	for _, scaleSet := range scaleSets {
+		s.logger.Infof("resume requested for %s", scaleSet.Name())
+		scaleSet.Resume()
+	}
+
+	writeScaleSets(w, http.StatusOK, scaleSets)
+}
+
+func (s *Server) handleDeleteVM(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	for _, scaleSet := range s.scaleSets {
+		if scaleSet.CancelRunner(name) {
+			s.logger.Infof("canceled runner %s of %s", name, scaleSet.Name())
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusNotFound, errorResponse{Error: "no active runner with name " + name})
+}
+
+// selectScaleSets returns the scale set named by the scaleSet query parameter, or all scale sets when it is not set.
+// It responds with 404 and returns false when there is no scale set with the name.
+func (s *Server) selectScaleSets(w http.ResponseWriter, r *http.Request) ([]ScaleSet, bool) {
+	name := r.URL.Query().Get("scaleSet")
+	if name == "" {
+		return s.scaleSets, true
+	}
+
+	for _, scaleSet := range s.scaleSets {
+		if scaleSet.Name() == name {
+			return []ScaleSet{scaleSet}, true
+		}
+	}
+
+	writeJSON(w, http.StatusNotFound, errorResponse{Error: "no scale set with name " + name})
+	return nil, false
+}
+
+func scaleSetStatus(scaleSet ScaleSet) ScaleSetStatus {
+	return ScaleSetStatus{
+		Name:          scaleSet.Name(),
+		Paused:        scaleSet.Paused(),
+		Draining:      scaleSet.Draining(),
+		ActiveRunners: scaleSet.ActiveRunners(),
+	}
+}
+
+func writeScaleSets(w http.ResponseWriter, statusCode int, scaleSets []ScaleSet) {
+	statuses := make([]ScaleSetStatus, 0, len(scaleSets))
+	for _, scaleSet := range scaleSets {
+		statuses = append(statuses, scaleSetStatus(scaleSet))
+	}
+
+	writeJSON(w, statusCode, statuses)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
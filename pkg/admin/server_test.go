@@ -0,0 +1,144 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/state"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+func TestAdmin(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Admin Suite")
+}
+
+type fakeScaleSet struct {
+	name     string
+	paused   bool
+	draining bool
+	runners  map[string]bool
+	waitErr  error
+}
+
+func (f *fakeScaleSet) Name() string       { return f.name }
+func (f *fakeScaleSet) Pause()             { f.paused = true }
+func (f *fakeScaleSet) Resume()            { f.paused = false; f.draining = false }
+func (f *fakeScaleSet) Paused() bool       { return f.paused }
+func (f *fakeScaleSet) Drain()             { f.draining = true }
+func (f *fakeScaleSet) Draining() bool     { return f.draining }
+func (f *fakeScaleSet) ActiveRunners() int { return len(f.runners) }
+func (f *fakeScaleSet) WaitForRunners(ctx context.Context) error {
+	return f.waitErr
+}
+func (f *fakeScaleSet) CancelRunner(runnerName string) bool {
+	if !f.runners[runnerName] {
+		return false
+	}
+	delete(f.runners, runnerName)
+	return true
+}
+
+var _ = Describe("Server", func() {
+	var (
+		scaleSet *fakeScaleSet
+		other    *fakeScaleSet
+		store    *state.MemoryStore
+		handler  http.Handler
+	)
+
+	request := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	BeforeEach(func() {
+		scaleSet = &fakeScaleSet{name: "runner", runners: map[string]bool{"runner-abc12": true}}
+		other = &fakeScaleSet{name: "other", runners: map[string]bool{}}
+		store = state.NewMemoryStore()
+		Expect(store.Put(&state.Record{
+			RunnerName:   "runner-abc12",
+			ScaleSetName: "runner",
+			Namespace:    "orka-default",
+			JobId:        "job-1",
+			IP:           "10.0.0.1",
+			Phase:        state.PhaseRunning,
+			CreatedAt:    time.Now().Add(-time.Minute),
+		})).To(Succeed())
+
+		handler = NewServer([]ScaleSet{scaleSet, other}, store, "secret", zap.NewNop().Sugar()).Handler()
+	})
+
+	It("should reject requests without the token", func() {
+		Expect(request(http.MethodGet, "/status", "").Code).To(Equal(http.StatusUnauthorized))
+		Expect(request(http.MethodGet, "/status", "wrong").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should list the scale sets and active jobs", func() {
+		rec := request(http.MethodGet, "/status", "secret")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		var status Status
+		Expect(json.Unmarshal(rec.Body.Bytes(), &status)).To(Succeed())
+		Expect(status.ScaleSets).To(HaveLen(2))
+		Expect(status.Jobs).To(HaveLen(1))
+		Expect(status.Jobs[0].JobId).To(Equal("job-1"))
+		Expect(status.Jobs[0].VMName).To(Equal("runner-abc12"))
+		Expect(status.Jobs[0].IP).To(Equal("10.0.0.1"))
+		Expect(status.Jobs[0].Phase).To(Equal(state.PhaseRunning))
+		Expect(status.Jobs[0].Age).To(Equal("1m0s"))
+	})
+
+	It("should pause, drain and resume only the selected scale set", func() {
+		Expect(request(http.MethodPost, "/pause?scaleSet=runner", "secret").Code).To(Equal(http.StatusOK))
+		Expect(request(http.MethodPost, "/drain?scaleSet=runner&wait=true", "secret").Code).To(Equal(http.StatusAccepted))
+		Expect(scaleSet.Paused()).To(BeTrue())
+		Expect(scaleSet.Draining()).To(BeTrue())
+		Expect(other.Paused()).To(BeFalse())
+		Expect(other.Draining()).To(BeFalse())
+
+		Expect(request(http.MethodPost, "/resume", "secret").Code).To(Equal(http.StatusOK))
+		Expect(scaleSet.Paused()).To(BeFalse())
+		Expect(scaleSet.Draining()).To(BeFalse())
+	})
+
+	It("should reject an unknown scale set", func() {
+		for _, target := range []string{"/pause?scaleSet=missing", "/drain?scaleSet=missing", "/resume?scaleSet=missing"} {
+			Expect(request(http.MethodPost, target, "secret").Code).To(Equal(http.StatusNotFound))
+		}
+		Expect(request(http.MethodGet, "/status?scaleSet=missing", "secret").Code).To(Equal(http.StatusNotFound))
+		Expect(scaleSet.Paused()).To(BeFalse())
+		Expect(scaleSet.Draining()).To(BeFalse())
+	})
+
+	It("should report when waiting for the runners stops", func() {
+		scaleSet.waitErr = context.Canceled
+
+		rec := request(http.MethodPost, "/drain?scaleSet=runner&wait=true", "secret")
+		Expect(rec.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rec.Body.String()).To(ContainSubstring("context canceled"))
+		Expect(scaleSet.Draining()).To(BeTrue())
+	})
+
+	It("should cancel the runner of a VM", func() {
+		Expect(request(http.MethodDelete, "/vms/runner-abc12", "secret").Code).To(Equal(http.StatusAccepted))
+		Expect(scaleSet.runners).To(BeEmpty())
+
+		Expect(request(http.MethodDelete, "/vms/runner-abc12", "secret").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should only allow the documented methods", func() {
+		Expect(request(http.MethodGet, "/drain", "secret").Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
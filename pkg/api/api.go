@@ -4,12 +4,31 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func RequestJSON[Req any, Res any](ctx context.Context, client *http.Client, method string, path string, body *Req) (*Res, error) {
+// HTTPError is returned by RequestJSON when the server responds with a non-success status code.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Body
+}
+
+func RequestJSON[Req any, Res any](ctx context.Context, client *http.Client, method string, path string, body *Req) (_ *Res, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "HTTP "+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", method),
+		attribute.String("url.full", path),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	buffer := bytes.Buffer{}
 	if body != nil {
 		if err := json.NewEncoder(&buffer).Encode(body); err != nil {
@@ -28,6 +47,8 @@ func RequestJSON[Req any, Res any](ctx context.Context, client *http.Client, met
 	}
 	defer response.Body.Close()
 
+	span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+
 	isSuccessStatusCode := response.StatusCode >= 200 && response.StatusCode <= 299
 	if !isSuccessStatusCode {
 		body, err := io.ReadAll(response.Body)
@@ -35,7 +56,11 @@ func RequestJSON[Req any, Res any](ctx context.Context, client *http.Client, met
 			return nil, err
 		}
 
-		return nil, fmt.Errorf("%s", string(body))
+		return nil, &HTTPError{StatusCode: response.StatusCode, Body: string(body)}
+	}
+
+	if response.StatusCode == http.StatusNoContent {
+		return nil, nil
 	}
 
 	responseModel := new(Res)
@@ -3,4 +3,5 @@ package constants
 const (
 	BaseGitHubAPIPath    = "https://api.github.com"
 	DefaultRunnerGroupID = 1
+	RunnerReleasesURL    = "https://github.com/actions/runner/releases/download"
 )
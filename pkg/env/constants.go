@@ -1,17 +1,27 @@
 package env
 
+import "time"
+
+const defaultWarmPoolMaxIdleAge = time.Hour
+
 const (
-	GitHubAppIDEnvName             = "GITHUB_APP_ID"
-	GitHubAppInstallationIDEnvName = "GITHUB_APP_INSTALLATION_ID"
-	GitHubAppPrivateKeyPathEnvName = "GITHUB_APP_PRIVATE_KEY_PATH"
-	GitHubAppPrivateKeyEnvName     = "GITHUB_APP_PRIVATE_KEY"
-	GitHubURLEnvName               = "GITHUB_URL"
-	GitHubAPIURLEnvName            = "GITHUB_API_URL"
-	GitHubRunnerVersionEnvName     = "GITHUB_RUNNER_VERSION"
-	GitHubTokenEnvName             = "GITHUB_TOKEN" // Token for public GitHub API authentication
-
-	OrkaURLEnvName   = "ORKA_URL"
-	OrkaTokenEnvName = "ORKA_TOKEN"
+	GitHubAppIDEnvName                   = "GITHUB_APP_ID"
+	GitHubAppInstallationIDEnvName       = "GITHUB_APP_INSTALLATION_ID"
+	GitHubAppPrivateKeyPathEnvName       = "GITHUB_APP_PRIVATE_KEY_PATH"
+	GitHubAppPrivateKeyEnvName           = "GITHUB_APP_PRIVATE_KEY"
+	GitHubAppPrivateKeyPassphraseEnvName = "GITHUB_APP_PRIVATE_KEY_PASSPHRASE"
+	GitHubURLEnvName                     = "GITHUB_URL"
+	GitHubAPIURLEnvName                  = "GITHUB_API_URL"
+	GitHubRunnerVersionEnvName           = "GITHUB_RUNNER_VERSION"
+	GitHubTokenEnvName                   = "GITHUB_TOKEN" // Token for public GitHub API authentication
+	GitHubPATEnvName                     = "GITHUB_PAT"
+
+	GitHubAPIRateLimitEnvName      = "GITHUB_API_RATE_LIMIT"
+	GitHubAPIRateLimitBurstEnvName = "GITHUB_API_RATE_LIMIT_BURST"
+
+	OrkaURLEnvName           = "ORKA_URL"
+	OrkaTokenEnvName         = "ORKA_TOKEN"
+	OrkaClientBackendEnvName = "ORKA_CLIENT_BACKEND"
 
 	OrkaNamespaceEnvName  = "ORKA_NAMESPACE"
 	OrkaVMConfigEnvName   = "ORKA_VM_CONFIG"
@@ -19,22 +29,65 @@ const (
 	OrkaVMPasswordEnvName = "ORKA_VM_PASSWORD"
 	OrkaVMMetadataEnvName = "ORKA_VM_METADATA"
 
+	OrkaVMSSHKeyEnvName              = "ORKA_VM_SSH_KEY"
+	OrkaVMSSHKeyPathEnvName          = "ORKA_VM_SSH_KEY_PATH"
+	OrkaVMSSHKeyPassphraseEnvName    = "ORKA_VM_SSH_KEY_PASSPHRASE"
+	OrkaVMKnownHostsPathEnvName      = "ORKA_VM_KNOWN_HOSTS_PATH"
+	OrkaVMHostKeyFromMetadataEnvName = "ORKA_VM_HOST_KEY_FROM_METADATA"
+
 	OrkaEnableNodeIPMappingEnvName = "ORKA_ENABLE_NODE_IP_MAPPING"
 	OrkaNodeIPMappingEnvName       = "ORKA_NODE_IP_MAPPING"
 
-	RunnersEnvName = "RUNNERS"
+	OrkaCapacityCheckEnvName        = "ORKA_CAPACITY_CHECK"
+	OrkaCapacityPollIntervalEnvName = "ORKA_CAPACITY_POLL_INTERVAL"
+
+	RunnersEnvName    = "RUNNERS"
+	MaxRunnersEnvName = "MAX_RUNNERS"
+
+	RunnerBootstrapTemplatePathEnvName = "RUNNER_BOOTSTRAP_TEMPLATE_PATH"
+
+	PostJobHookTimeoutEnvName = "POST_JOB_HOOK_TIMEOUT"
+
+	RunnerDownloadURLEnvName     = "RUNNER_DOWNLOAD_URL"
+	RunnerSHA256ChecksumsEnvName = "RUNNER_SHA256_CHECKSUMS"
+	EnableRunnerCacheEnvName     = "ENABLE_RUNNER_CACHE"
+	RunnerCacheAddrEnvName       = "RUNNER_CACHE_ADDR"
+	RunnerCacheDirEnvName        = "RUNNER_CACHE_DIR"
+	RunnerCacheURLEnvName        = "RUNNER_CACHE_URL"
 
 	RunnerDeregistrationTimeoutEnvName      = "RUNNER_DEREGISTRATION_TIMEOUT"
 	RunnerDeregistrationPollIntervalEnvName = "RUNNER_DEREGISTRATION_POLL_INTERVAL"
 
 	VMTrackerIntervalEnvName = "VM_TRACKER_INTERVAL"
 
+	DrainTimeoutEnvName = "DRAIN_TIMEOUT"
+
+	StateStorePathEnvName = "STATE_STORE_PATH"
+
+	OrphanSweepEnabledEnvName     = "ORPHAN_SWEEP_ENABLED"
+	OrphanSweepIntervalEnvName    = "ORPHAN_SWEEP_INTERVAL"
+	OrphanSweepGracePeriodEnvName = "ORPHAN_SWEEP_GRACE_PERIOD"
+	OrphanSweepDryRunEnvName      = "ORPHAN_SWEEP_DRY_RUN"
+
 	LogLevelEnvName = "LOG_LEVEL"
 
+	ControllerIdEnvName = "CONTROLLER_ID"
+
 	// Prometheus metrics
 	EnableMetricsEnvName       = "ENABLE_METRICS"
 	MetricsAddrEnvName         = "METRICS_ADDR"
 	MetricsPollIntervalEnvName = "METRICS_POLL_INTERVAL"
 
 	ManageRunnerScaleSetsEnvName = "MANAGE_RUNNER_SCALE_SETS"
+
+	// Admin API
+	EnableAdminAPIEnvName = "ENABLE_ADMIN_API"
+	AdminAPIAddrEnvName   = "ADMIN_API_ADDR"
+	AdminAPITokenEnvName  = "ADMIN_API_TOKEN"
+
+	EnableTracingEnvName = "ENABLE_TRACING"
+
+	EnableHealthProbesEnvName       = "ENABLE_HEALTH_PROBES"
+	HealthProbesAddrEnvName         = "HEALTH_PROBES_ADDR"
+	HealthMessageLoopTimeoutEnvName = "HEALTH_MESSAGE_LOOP_TIMEOUT"
 )
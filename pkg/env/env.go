@@ -1,38 +1,122 @@
 package env
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/macstadium/orka-github-actions-integration/pkg/constants"
+	"github.com/macstadium/orka-github-actions-integration/pkg/github"
 	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
+	"github.com/macstadium/orka-github-actions-integration/pkg/utils"
 	"github.com/macstadium/orka-github-actions-integration/pkg/version"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 type Runner struct {
 	Name string
 	Id   int
+
+	// Group is the name of the runner group of the scale set. It is resolved to its id through the GitHub API and
+	// cannot be combined with Id.
+	Group string `json:"group"`
+	// CreateGroup creates the runner group when it does not exist yet.
+	CreateGroup *RunnerGroupSettings `json:"createGroup"`
+
+	// Labels are registered with the runner scale set in addition to its name.
+	Labels []string `json:"labels"`
+
+	// Optional overrides of the global Orka settings. Empty values are
+	// resolved from the corresponding ORKA_* environment variables.
+	OrkaVMConfig   string `json:"vmConfig"`
+	OrkaNamespace  string `json:"namespace"`
+	OrkaVMUsername string `json:"vmUsername"`
+	OrkaVMPassword string `json:"vmPassword"`
+	OrkaVMMetadata string `json:"vmMetadata"`
+
+	// LabelVMConfigs routes jobs to other VM configs than OrkaVMConfig by the labels they request.
+	LabelVMConfigs []LabelVMConfig `json:"labelVMConfigs"`
+
+	WarmPool *WarmPool `json:"warmPool"`
+
+	// MaxRunners caps the number of VMs of this scale set that exist at the same time, including the VMs of the warm
+	// pool. Zero means no limit.
+	MaxRunners int `json:"maxRunners"`
+	// MinRunners is the number of idle runners that are kept registered and waiting for jobs.
+	MinRunners int `json:"minRunners"`
+
+	// PreJobHooks and PostJobHooks are the file paths of the scripts that run on the VM before the runner starts and
+	// after it exits. The scripts are loaded into PreJobHookTemplates and PostJobHookTemplates.
+	PreJobHooks          []string             `json:"preJobHooks"`
+	PostJobHooks         []string             `json:"postJobHooks"`
+	PreJobHookTemplates  []*template.Template `json:"-"`
+	PostJobHookTemplates []*template.Template `json:"-"`
+
+	// BootstrapTemplatePath overrides RUNNER_BOOTSTRAP_TEMPLATE_PATH. The template is loaded into BootstrapTemplate, which
+	// is nil when the built-in bootstrap script is used.
+	BootstrapTemplatePath string             `json:"bootstrapTemplate"`
+	BootstrapTemplate     *template.Template `json:"-"`
+}
+
+// RunnerGroupSettings configures the runner group that is created for a runner.
+type RunnerGroupSettings struct {
+	// Visibility is one of `all`, `selected` or `private`.
+	Visibility string `json:"visibility"`
+	// Repositories are the names of the repositories that may use the group when the visibility is `selected`.
+	Repositories []string `json:"repositories"`
+}
+
+// LabelVMConfig deploys jobs that request all of the labels with the VM config.
+type LabelVMConfig struct {
+	Labels   []string `json:"labels"`
+	VMConfig string   `json:"vmConfig"`
+}
+
+// WarmPool configures the VMs that are deployed and prepared in advance for a runner.
+type WarmPool struct {
+	MinSize int `json:"min"`
+	MaxSize int `json:"max"`
+
+	// MaxIdleAge is a duration string, for example, "2h". Ready VMs that stay idle
+	// for longer than this are deleted and replaced with fresh ones.
+	MaxIdleAge         string        `json:"maxIdleAge"`
+	MaxIdleAgeDuration time.Duration `json:"-"`
 }
 
 type Data struct {
 	GitHubAppID             int64
 	GitHubAppInstallationID int64
 	GitHubAppPrivateKey     string
-	GitHubURL               string
-	GitHubAPIUrl            string
-	GitHubRunnerVersion     string
-	GitHubToken             string // Token for authenticating with public GitHub API
-
-	OrkaURL   string
-	OrkaToken string
+	// GitHubAppPrivateKeyPath is read again on every token refresh, so that a rotated key applies without a restart.
+	GitHubAppPrivateKeyPath       string
+	GitHubAppPrivateKeyPassphrase string
+	GitHubURL                     string
+	GitHubAPIUrl                  string
+	GitHubRunnerVersion           string
+	GitHubToken                   string // Token for authenticating with public GitHub API
+	// GitHubPAT is a personal access token that authenticates with GitHub instead of the GitHub App.
+	GitHubPAT string
+
+	// GitHubAPIRateLimit caps the GitHub API requests per hour across all clients. Zero means no limit.
+	GitHubAPIRateLimit      int
+	GitHubAPIRateLimitBurst int
+
+	OrkaURL           string
+	OrkaToken         string
+	OrkaClientBackend string
 
 	OrkaNamespace  string
 	OrkaVMConfig   string
@@ -40,23 +124,72 @@ type Data struct {
 	OrkaVMPassword string
 	OrkaVMMetadata string
 
+	// OrkaVMSSHKey is the optional PEM encoded private key used to connect to the VMs. OrkaVMSSHSigner is parsed from it.
+	OrkaVMSSHKey              string
+	OrkaVMSSHKeyPassphrase    string
+	OrkaVMSSHSigner           ssh.Signer
+	OrkaVMKnownHostsPath      string
+	OrkaVMHostKeyFromMetadata bool
+
 	OrkaEnableNodeIPMapping bool
 	OrkaNodeIPMapping       map[string]string
 
+	OrkaCapacityCheck        bool
+	OrkaCapacityPollInterval time.Duration
+
 	Runners []Runner
 
+	RunnerBootstrapTemplatePath string
+
+	// RunnerDownloadURL is the base URL of the runner releases, which is GitHub or a mirror with the same layout.
+	RunnerDownloadURL string
+	// RunnerSHA256Checksums are the expected SHA-256 checksums of the runner tarballs by architecture.
+	RunnerSHA256Checksums map[string]string
+
+	EnableRunnerCache bool
+	RunnerCacheAddr   string
+	RunnerCacheDir    string
+	RunnerCacheURL    string
+
+	MaxRunners int
+
 	RunnerDeregistrationTimeout      time.Duration
 	RunnerDeregistrationPollInterval time.Duration
 
 	VMTrackerInterval time.Duration
 
+	DrainTimeout time.Duration
+
+	// PostJobHookTimeout is how long the post-job hooks may run after GitHub reported the job as completed. Zero stops
+	// them when the job completes.
+	PostJobHookTimeout time.Duration
+
+	StateStorePath string
+
+	OrphanSweepEnabled     bool
+	OrphanSweepInterval    time.Duration
+	OrphanSweepGracePeriod time.Duration
+	OrphanSweepDryRun      bool
+
 	LogLevel string
 
+	ControllerId string
+
 	EnableMetrics       bool
 	MetricsAddr         string
 	MetricsPollInterval time.Duration
 
 	ManageRunnerScaleSets bool
+
+	EnableAdminAPI bool
+	AdminAPIAddr   string
+	AdminAPIToken  string
+
+	EnableTracing bool
+
+	EnableHealthProbes       bool
+	HealthProbesAddr         string
+	HealthMessageLoopTimeout time.Duration
 }
 
 func ParseEnv() *Data {
@@ -65,14 +198,20 @@ func ParseEnv() *Data {
 	}
 
 	envData := &Data{
-		GitHubAppPrivateKey: os.Getenv(GitHubAppPrivateKeyEnvName),
-		GitHubURL:           os.Getenv(GitHubURLEnvName),
-		GitHubAPIUrl:        os.Getenv(GitHubAPIURLEnvName),
-		GitHubRunnerVersion: os.Getenv(GitHubRunnerVersionEnvName),
-		GitHubToken:         os.Getenv(GitHubTokenEnvName),
+		GitHubAppPrivateKey:           os.Getenv(GitHubAppPrivateKeyEnvName),
+		GitHubAppPrivateKeyPassphrase: os.Getenv(GitHubAppPrivateKeyPassphraseEnvName),
+		GitHubURL:                     os.Getenv(GitHubURLEnvName),
+		GitHubAPIUrl:                  os.Getenv(GitHubAPIURLEnvName),
+		GitHubRunnerVersion:           os.Getenv(GitHubRunnerVersionEnvName),
+		GitHubToken:                   os.Getenv(GitHubTokenEnvName),
+		GitHubPAT:                     os.Getenv(GitHubPATEnvName),
 
-		OrkaURL:   os.Getenv(OrkaURLEnvName),
-		OrkaToken: os.Getenv(OrkaTokenEnvName),
+		GitHubAPIRateLimit:      getIntEnv(GitHubAPIRateLimitEnvName, 0),
+		GitHubAPIRateLimitBurst: getIntEnv(GitHubAPIRateLimitBurstEnvName, 10),
+
+		OrkaURL:           os.Getenv(OrkaURLEnvName),
+		OrkaToken:         os.Getenv(OrkaTokenEnvName),
+		OrkaClientBackend: getEnvWithDefault(OrkaClientBackendEnvName, "api"),
 
 		OrkaNamespace:  getEnvWithDefault(OrkaNamespaceEnvName, "orka-default"),
 		OrkaVMConfig:   os.Getenv(OrkaVMConfigEnvName),
@@ -80,20 +219,62 @@ func ParseEnv() *Data {
 		OrkaVMPassword: getEnvWithDefault(OrkaVMPasswordEnvName, "admin"),
 		OrkaVMMetadata: getEnvWithDefault(OrkaVMMetadataEnvName, ""),
 
+		OrkaVMSSHKey:              os.Getenv(OrkaVMSSHKeyEnvName),
+		OrkaVMSSHKeyPassphrase:    os.Getenv(OrkaVMSSHKeyPassphraseEnvName),
+		OrkaVMKnownHostsPath:      os.Getenv(OrkaVMKnownHostsPathEnvName),
+		OrkaVMHostKeyFromMetadata: getBoolEnv(OrkaVMHostKeyFromMetadataEnvName, false),
+
 		OrkaEnableNodeIPMapping: getBoolEnv(OrkaEnableNodeIPMappingEnvName, false),
 
+		OrkaCapacityCheck:        getBoolEnv(OrkaCapacityCheckEnvName, false),
+		OrkaCapacityPollInterval: getDurationEnv(OrkaCapacityPollIntervalEnvName, 15*time.Second),
+
 		RunnerDeregistrationTimeout:      getDurationEnv(RunnerDeregistrationTimeoutEnvName, 30*time.Second),
 		RunnerDeregistrationPollInterval: getDurationEnv(RunnerDeregistrationPollIntervalEnvName, 2*time.Second),
 
+		MaxRunners: getIntEnv(MaxRunnersEnvName, 0),
+
+		RunnerBootstrapTemplatePath: os.Getenv(RunnerBootstrapTemplatePathEnvName),
+
+		RunnerDownloadURL: strings.TrimSuffix(getEnvWithDefault(RunnerDownloadURLEnvName, constants.RunnerReleasesURL), "/"),
+
+		EnableRunnerCache: getBoolEnv(EnableRunnerCacheEnvName, false),
+		RunnerCacheAddr:   getEnvWithDefault(RunnerCacheAddrEnvName, ":8082"),
+		RunnerCacheDir:    getEnvWithDefault(RunnerCacheDirEnvName, filepath.Join(os.TempDir(), "orka-github-runner-cache")),
+		RunnerCacheURL:    strings.TrimSuffix(os.Getenv(RunnerCacheURLEnvName), "/"),
+
 		VMTrackerInterval: getDurationEnv(VMTrackerIntervalEnvName, 300*time.Second),
 
+		DrainTimeout: getDurationEnv(DrainTimeoutEnvName, 10*time.Minute),
+
+		PostJobHookTimeout: getDurationEnv(PostJobHookTimeoutEnvName, 10*time.Minute),
+
+		StateStorePath: os.Getenv(StateStorePathEnvName),
+
+		OrphanSweepEnabled:     getBoolEnv(OrphanSweepEnabledEnvName, true),
+		OrphanSweepInterval:    getDurationEnv(OrphanSweepIntervalEnvName, 5*time.Minute),
+		OrphanSweepGracePeriod: getDurationEnv(OrphanSweepGracePeriodEnvName, 10*time.Minute),
+		OrphanSweepDryRun:      getBoolEnv(OrphanSweepDryRunEnvName, false),
+
 		LogLevel: getEnvWithDefault(LogLevelEnvName, logging.LogLevelInfo),
 
+		ControllerId: getEnvWithDefault(ControllerIdEnvName, DefaultControllerId(os.Getenv(GitHubURLEnvName))),
+
 		EnableMetrics:       getBoolEnv(EnableMetricsEnvName, false),
 		MetricsAddr:         getEnvWithDefault(MetricsAddrEnvName, ":8080"),
 		MetricsPollInterval: getDurationEnv(MetricsPollIntervalEnvName, 30*time.Second),
 
 		ManageRunnerScaleSets: getBoolEnv(ManageRunnerScaleSetsEnvName, false),
+
+		EnableAdminAPI: getBoolEnv(EnableAdminAPIEnvName, false),
+		AdminAPIAddr:   getEnvWithDefault(AdminAPIAddrEnvName, "127.0.0.1:8090"),
+		AdminAPIToken:  os.Getenv(AdminAPITokenEnvName),
+
+		EnableTracing: getBoolEnv(EnableTracingEnvName, false),
+
+		EnableHealthProbes:       getBoolEnv(EnableHealthProbesEnvName, false),
+		HealthProbesAddr:         getEnvWithDefault(HealthProbesAddrEnvName, ":8081"),
+		HealthMessageLoopTimeout: getDurationEnv(HealthMessageLoopTimeoutEnvName, 5*time.Minute),
 	}
 
 	envData.OrkaURL = strings.TrimSuffix(envData.OrkaURL, "/")
@@ -117,29 +298,42 @@ func ParseEnv() *Data {
 		}
 	}
 
-	if appID, err := strconv.ParseInt(os.Getenv(GitHubAppIDEnvName), 10, 64); err != nil {
-		errors = append(errors, fmt.Sprintf("%s is not set to a valid number: %s", GitHubAppIDEnvName, err))
-	} else {
-		envData.GitHubAppID = appID
-	}
-
-	if installationID, err := strconv.ParseInt(os.Getenv(GitHubAppInstallationIDEnvName), 10, 64); err != nil {
-		errors = append(errors, fmt.Sprintf("%s is not set to a valid number: %s", GitHubAppInstallationIDEnvName, err))
+	if envData.GitHubPAT != "" {
+		for _, name := range []string{GitHubAppIDEnvName, GitHubAppInstallationIDEnvName, GitHubAppPrivateKeyEnvName, GitHubAppPrivateKeyPathEnvName, GitHubAppPrivateKeyPassphraseEnvName} {
+			if os.Getenv(name) != "" {
+				errors = append(errors, fmt.Sprintf("%s must not be set together with %s", name, GitHubPATEnvName))
+			}
+		}
 	} else {
-		envData.GitHubAppInstallationID = installationID
+		errors = append(errors, parseGitHubApp(envData)...)
 	}
 
-	if envData.GitHubAppPrivateKey == "" {
-		gitHubAppPrivateKeyPath := os.Getenv(GitHubAppPrivateKeyPathEnvName)
-		if gitHubAppPrivateKeyPath == "" {
-			errors = append(errors, fmt.Sprintf("GitHub App private key is required. Please provide either a file path to the private key using %s env or the private key directly using %s env variable", GitHubAppPrivateKeyPathEnvName, GitHubAppPrivateKeyEnvName))
-		} else {
-			privateKeyContent, err := os.ReadFile(gitHubAppPrivateKeyPath)
+	if envData.OrkaVMSSHKey == "" {
+		if sshKeyPath := os.Getenv(OrkaVMSSHKeyPathEnvName); sshKeyPath != "" {
+			sshKeyContent, err := os.ReadFile(sshKeyPath)
 			if err != nil {
 				errors = append(errors, err.Error())
 			}
 
-			envData.GitHubAppPrivateKey = string(privateKeyContent)
+			envData.OrkaVMSSHKey = string(sshKeyContent)
+		}
+	}
+
+	if envData.OrkaVMSSHKey != "" {
+		if signer, err := parseSSHKey(envData.OrkaVMSSHKey, envData.OrkaVMSSHKeyPassphrase); err != nil {
+			errors = append(errors, fmt.Sprintf("unable to parse the VM SSH private key: %s", err))
+		} else {
+			envData.OrkaVMSSHSigner = signer
+		}
+	}
+
+	if checksums := os.Getenv(RunnerSHA256ChecksumsEnvName); checksums != "" {
+		if err := json.Unmarshal([]byte(checksums), &envData.RunnerSHA256Checksums); err != nil {
+			errors = append(errors, fmt.Sprintf("%s must be a JSON object of architectures and checksums: %s", RunnerSHA256ChecksumsEnvName, err))
+		}
+
+		for arch, checksum := range envData.RunnerSHA256Checksums {
+			envData.RunnerSHA256Checksums[arch] = strings.ToLower(checksum)
 		}
 	}
 
@@ -165,23 +359,26 @@ func ParseEnv() *Data {
 	if runners, err := getRunnersFromEnv(); err != nil {
 		errors = append(errors, err.Error())
 	} else {
-		envData.Runners = runners
-	}
-
-	if !regexp.MustCompile(`^https?://.+`).MatchString(envData.OrkaURL) {
-		errors = append(errors, fmt.Sprintf("%s env is required and must be set to the Orka API URL of the Orka cluster, for example, `http://10.221.188.20`", OrkaURLEnvName))
-	}
+		for i := range runners {
+			resolveRunner(&runners[i], envData)
 
-	if envData.OrkaToken == "" {
-		errors = append(errors, fmt.Sprintf("%s env is required and must be set to a valid JWT token from the Orka cluster", OrkaTokenEnvName))
-	}
+			if runners[i].PreJobHookTemplates, err = loadHooks(runners[i].PreJobHooks); err != nil {
+				errors = append(errors, fmt.Sprintf("invalid preJobHooks of runner %s: %s", runners[i].Name, err))
+			}
 
-	if envData.OrkaVMConfig == "" {
-		errors = append(errors, fmt.Sprintf("%s env is required and must be set to a valid and existing VM config in the Orka cluster", OrkaVMConfigEnvName))
-	}
+			if runners[i].PostJobHookTemplates, err = loadHooks(runners[i].PostJobHooks); err != nil {
+				errors = append(errors, fmt.Sprintf("invalid postJobHooks of runner %s: %s", runners[i].Name, err))
+			}
 
-	if envData.OrkaVMMetadata != "" && !validateMetadata(envData.OrkaVMMetadata) {
-		errors = append(errors, fmt.Sprintf("%s must be formatted as key=value comma separated string", OrkaVMMetadataEnvName))
+			if runners[i].BootstrapTemplatePath != "" {
+				if runners[i].BootstrapTemplate, err = loadTemplate(runners[i].BootstrapTemplatePath); err != nil {
+					errors = append(errors, fmt.Sprintf("invalid bootstrap template of runner %s: %s", runners[i].Name, err))
+				} else if runners[i].BootstrapTemplate.Lookup("prepare") != nil && runners[i].BootstrapTemplate.Lookup("run") == nil {
+					errors = append(errors, fmt.Sprintf("bootstrap template of runner %s defines `prepare` but not `run`", runners[i].Name))
+				}
+			}
+		}
+		envData.Runners = runners
 	}
 
 	if errs := validateEnv(envData); len(errs) > 0 {
@@ -228,6 +425,33 @@ func getDurationEnv(key string, fallback time.Duration) time.Duration {
 	return duration
 }
 
+// DefaultControllerId derives the controller ID from the GitHub URL. Unlike the hostname, which changes with every pod
+// of a deployment, it stays the same across restarts, so that a new process cleans up the VMs of its predecessor. The
+// ownership metadata also carries the scale set name, which is unique for a GitHub URL.
+func DefaultControllerId(gitHubURL string) string {
+	if gitHubURL == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSuffix(gitHubURL, "/"))))
+	return "orka-github-runner-" + hex.EncodeToString(sum[:])[:12]
+}
+
+func getIntEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+
+	if len(value) == 0 {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+
+	return number
+}
+
 func getRunnersFromEnv() ([]Runner, error) {
 	values := os.Getenv(RunnersEnvName)
 
@@ -236,9 +460,61 @@ func getRunnersFromEnv() ([]Runner, error) {
 		return nil, fmt.Errorf(`unable to parse the %s environment variable as a JSON array of runners. Make sure the variable is correctly set with a valid JSON array, for example, '[{"name":"my-test-runner", "id": 1}]'`, RunnersEnvName)
 	}
 
+	if len(runners) == 0 {
+		return nil, fmt.Errorf("%s must contain at least one runner", RunnersEnvName)
+	}
+
+	names := map[string]bool{}
+	for _, runner := range runners {
+		if names[runner.Name] {
+			return nil, fmt.Errorf("%s contains more than one runner with name %s. Runner names must be unique", RunnersEnvName, runner.Name)
+		}
+		names[runner.Name] = true
+	}
+
 	return runners, nil
 }
 
+// parseGitHubApp reads the GitHub App credentials, which are required unless a personal access token is configured.
+func parseGitHubApp(envData *Data) []string {
+	errors := []string{}
+
+	if appID, err := strconv.ParseInt(os.Getenv(GitHubAppIDEnvName), 10, 64); err != nil {
+		errors = append(errors, fmt.Sprintf("%s is not set to a valid number: %s", GitHubAppIDEnvName, err))
+	} else {
+		envData.GitHubAppID = appID
+	}
+
+	if installationID, err := strconv.ParseInt(os.Getenv(GitHubAppInstallationIDEnvName), 10, 64); err != nil {
+		errors = append(errors, fmt.Sprintf("%s is not set to a valid number: %s", GitHubAppInstallationIDEnvName, err))
+	} else {
+		envData.GitHubAppInstallationID = installationID
+	}
+
+	if envData.GitHubAppPrivateKey == "" {
+		gitHubAppPrivateKeyPath := os.Getenv(GitHubAppPrivateKeyPathEnvName)
+		if gitHubAppPrivateKeyPath == "" {
+			errors = append(errors, fmt.Sprintf("GitHub App private key is required. Please provide either a file path to the private key using %s env or the private key directly using %s env variable", GitHubAppPrivateKeyPathEnvName, GitHubAppPrivateKeyEnvName))
+		} else {
+			privateKeyContent, err := os.ReadFile(gitHubAppPrivateKeyPath)
+			if err != nil {
+				errors = append(errors, err.Error())
+			}
+
+			envData.GitHubAppPrivateKey = string(privateKeyContent)
+			envData.GitHubAppPrivateKeyPath = gitHubAppPrivateKeyPath
+		}
+	}
+
+	if envData.GitHubAppPrivateKey != "" {
+		if _, err := utils.ParseRSAPrivateKey([]byte(envData.GitHubAppPrivateKey), envData.GitHubAppPrivateKeyPassphrase); err != nil {
+			errors = append(errors, fmt.Sprintf("invalid GitHub App private key: %v", err))
+		}
+	}
+
+	return errors
+}
+
 func validateEnv(envData *Data) []string {
 	errors := []string{}
 
@@ -246,6 +522,10 @@ func validateEnv(envData *Data) []string {
 		errors = append(errors, fmt.Sprintf("%s env is required and must be set to the GitHub repository or organization URL, for example, 'https://github.com/your-username/your-repository'", GitHubURLEnvName))
 	}
 
+	if config, err := github.NewGitHubConfig(envData.GitHubURL); err == nil && config.Scope == github.GitHubScopeEnterprise && envData.GitHubPAT == "" {
+		errors = append(errors, fmt.Sprintf("%s env is required for enterprise URLs, because GitHub Apps cannot register enterprise runners", GitHubPATEnvName))
+	}
+
 	if !regexp.MustCompile(`^https?://.+`).MatchString(envData.OrkaURL) {
 		errors = append(errors, fmt.Sprintf("%s env is required and must be set to the Orka API URL of the Orka cluster, for example, `http://10.221.188.20`", OrkaURLEnvName))
 	}
@@ -254,18 +534,328 @@ func validateEnv(envData *Data) []string {
 		errors = append(errors, fmt.Sprintf("%s env is required and must be set to a valid JWT token from the Orka cluster", OrkaTokenEnvName))
 	}
 
-	if envData.OrkaVMConfig == "" {
-		errors = append(errors, fmt.Sprintf("%s env is required and must be set to a valid and existing VM config in the Orka cluster", OrkaVMConfigEnvName))
+	if envData.OrkaClientBackend != "api" && envData.OrkaClientBackend != "cli" {
+		errors = append(errors, fmt.Sprintf("%s must be set to either `api` or `cli`", OrkaClientBackendEnvName))
 	}
 
 	if envData.OrkaVMMetadata != "" && !validateMetadata(envData.OrkaVMMetadata) {
 		errors = append(errors, fmt.Sprintf("%s must be formatted as key=value comma separated string", OrkaVMMetadataEnvName))
 	}
 
+	if envData.OrkaVMKnownHostsPath != "" {
+		if _, err := knownhosts.New(envData.OrkaVMKnownHostsPath); err != nil {
+			errors = append(errors, fmt.Sprintf("%s must point to a valid known_hosts file: %s", OrkaVMKnownHostsPathEnvName, err))
+		}
+	}
+
+	if envData.OrkaVMKnownHostsPath != "" && envData.OrkaVMHostKeyFromMetadata {
+		errors = append(errors, fmt.Sprintf("%s and %s cannot be used together", OrkaVMKnownHostsPathEnvName, OrkaVMHostKeyFromMetadataEnvName))
+	}
+
+	for _, runner := range envData.Runners {
+		if runner.OrkaVMConfig == "" {
+			errors = append(errors, fmt.Sprintf("%s env is required and must be set to a valid and existing VM config in the Orka cluster, unless runner %s sets its own vmConfig", OrkaVMConfigEnvName, runner.Name))
+		}
+
+		if runner.OrkaVMMetadata != envData.OrkaVMMetadata && !validateMetadata(runner.OrkaVMMetadata) {
+			errors = append(errors, fmt.Sprintf("vmMetadata of runner %s must be formatted as key=value comma separated string", runner.Name))
+		}
+
+		for _, label := range runner.Labels {
+			if strings.TrimSpace(label) == "" {
+				errors = append(errors, fmt.Sprintf("labels of runner %s must not be empty", runner.Name))
+			}
+		}
+
+		for _, labelVMConfig := range runner.LabelVMConfigs {
+			if len(labelVMConfig.Labels) == 0 || labelVMConfig.VMConfig == "" {
+				errors = append(errors, fmt.Sprintf("every labelVMConfigs entry of runner %s must set labels and a vmConfig", runner.Name))
+			}
+		}
+
+		// GitHub assigns jobs to idle runners regardless of the labels they request, so a job that an idle runner picks up
+		// would never get a VM of its routed VM config
+		if len(runner.LabelVMConfigs) > 0 && runner.MinRunners > 0 {
+			errors = append(errors, fmt.Sprintf("runner %s must not set minRunners together with labelVMConfigs", runner.Name))
+		}
+
+		if runner.Group != "" && runner.Id != 0 {
+			errors = append(errors, fmt.Sprintf("runner %s must not set both a group and an id", runner.Name))
+		}
+
+		if runner.CreateGroup != nil {
+			errors = append(errors, validateCreateGroup(&runner)...)
+		}
+
+		if runner.WarmPool != nil {
+			errors = append(errors, validateWarmPool(runner.Name, runner.WarmPool)...)
+		}
+
+		if runner.MinRunners < 0 || runner.MaxRunners < 0 {
+			errors = append(errors, fmt.Sprintf("minRunners and maxRunners of runner %s must not be negative", runner.Name))
+		}
+
+		if runner.MaxRunners > 0 && runner.MinRunners > runner.MaxRunners {
+			errors = append(errors, fmt.Sprintf("minRunners of runner %s must be less than or equal to maxRunners", runner.Name))
+		}
+
+		if runner.MaxRunners > 0 && runner.WarmPool != nil && runner.RunnerSlots() < 1 {
+			errors = append(errors, fmt.Sprintf("maxRunners of runner %s must be greater than its warmPool max", runner.Name))
+		}
+	}
+
+	if envData.ControllerId == "" {
+		errors = append(errors, fmt.Sprintf("%s env is required when %s is not set", ControllerIdEnvName, GitHubURLEnvName))
+	}
+
+	if envData.MaxRunners < 0 {
+		errors = append(errors, fmt.Sprintf("%s must not be negative", MaxRunnersEnvName))
+	}
+
+	if envData.MaxRunners > 0 && envData.RunnerSlots() < 1 {
+		errors = append(errors, fmt.Sprintf("%s must be greater than the sum of the warmPool max of all runners", MaxRunnersEnvName))
+	}
+
+	if envData.GitHubAPIRateLimit < 0 {
+		errors = append(errors, fmt.Sprintf("%s must not be negative", GitHubAPIRateLimitEnvName))
+	}
+
+	if envData.GitHubAPIRateLimit > 0 && envData.GitHubAPIRateLimitBurst < 1 {
+		errors = append(errors, fmt.Sprintf("%s must be at least 1", GitHubAPIRateLimitBurstEnvName))
+	}
+
+	if envData.EnableAdminAPI && envData.AdminAPIToken == "" && !isLoopbackAddr(envData.AdminAPIAddr) {
+		errors = append(errors, fmt.Sprintf("%s is required when the admin API listens on %s. Set it, or listen on a loopback address such as `127.0.0.1:8090`", AdminAPITokenEnvName, envData.AdminAPIAddr))
+	}
+
+	if envData.EnableHealthProbes && envData.HealthMessageLoopTimeout <= 0 {
+		errors = append(errors, fmt.Sprintf("%s must be a positive duration, for example, `5m`", HealthMessageLoopTimeoutEnvName))
+	}
+
+	if !regexp.MustCompile(`^https?://.+`).MatchString(envData.RunnerDownloadURL) {
+		errors = append(errors, fmt.Sprintf("%s must be an http or https URL", RunnerDownloadURLEnvName))
+	}
+
+	for arch, checksum := range envData.RunnerSHA256Checksums {
+		if arch != "arm64" && arch != "x64" {
+			errors = append(errors, fmt.Sprintf("%s contains the unknown architecture %s. Supported architectures are `arm64` and `x64`", RunnerSHA256ChecksumsEnvName, arch))
+		}
+
+		if !regexp.MustCompile(`^[0-9a-f]{64}$`).MatchString(checksum) {
+			errors = append(errors, fmt.Sprintf("%s contains an invalid SHA-256 checksum for %s", RunnerSHA256ChecksumsEnvName, arch))
+		}
+	}
+
+	if envData.EnableRunnerCache && !regexp.MustCompile(`^https?://.+`).MatchString(envData.RunnerCacheURL) {
+		errors = append(errors, fmt.Sprintf("%s is required when %s is enabled and must be the URL the VMs reach the cache at, for example, `http://10.221.188.5:8082`", RunnerCacheURLEnvName, EnableRunnerCacheEnvName))
+	}
+
+	if envData.DrainTimeout < 0 {
+		errors = append(errors, fmt.Sprintf("%s must not be negative", DrainTimeoutEnvName))
+	}
+
+	if envData.PostJobHookTimeout < 0 {
+		errors = append(errors, fmt.Sprintf("%s must not be negative", PostJobHookTimeoutEnvName))
+	}
+
 	return errors
 }
 
+func validateWarmPool(runnerName string, warmPool *WarmPool) []string {
+	errors := []string{}
+
+	if warmPool.MinSize < 0 || warmPool.MaxSize < 0 {
+		errors = append(errors, fmt.Sprintf("warmPool sizes of runner %s must not be negative", runnerName))
+	}
+
+	if warmPool.MaxSize < warmPool.MinSize {
+		errors = append(errors, fmt.Sprintf("warmPool max of runner %s must be greater than or equal to min", runnerName))
+	}
+
+	if warmPool.MaxIdleAgeDuration <= 0 {
+		errors = append(errors, fmt.Sprintf("warmPool maxIdleAge of runner %s must be a positive duration, for example, `2h`", runnerName))
+	}
+
+	return errors
+}
+
+func validateCreateGroup(runner *Runner) []string {
+	errors := []string{}
+
+	if runner.Group == "" {
+		errors = append(errors, fmt.Sprintf("createGroup of runner %s requires a group name", runner.Name))
+	}
+
+	switch runner.CreateGroup.Visibility {
+	case "", "all", "private":
+		if len(runner.CreateGroup.Repositories) > 0 {
+			errors = append(errors, fmt.Sprintf("createGroup repositories of runner %s require the `selected` visibility", runner.Name))
+		}
+	case "selected":
+	default:
+		errors = append(errors, fmt.Sprintf("createGroup visibility of runner %s must be one of `all`, `selected` or `private`", runner.Name))
+	}
+
+	return errors
+}
+
+// resolveRunner fills the Orka settings a runner does not override with the global values.
+func resolveRunner(runner *Runner, envData *Data) {
+	if runner.OrkaVMConfig == "" {
+		runner.OrkaVMConfig = envData.OrkaVMConfig
+	}
+
+	if runner.OrkaNamespace == "" {
+		runner.OrkaNamespace = envData.OrkaNamespace
+	}
+
+	if runner.OrkaVMUsername == "" {
+		runner.OrkaVMUsername = envData.OrkaVMUsername
+	}
+
+	if runner.OrkaVMPassword == "" {
+		runner.OrkaVMPassword = envData.OrkaVMPassword
+	}
+
+	if runner.OrkaVMMetadata == "" {
+		runner.OrkaVMMetadata = envData.OrkaVMMetadata
+	}
+
+	if runner.BootstrapTemplatePath == "" {
+		runner.BootstrapTemplatePath = envData.RunnerBootstrapTemplatePath
+	}
+
+	if runner.WarmPool != nil {
+		if runner.WarmPool.MaxSize == 0 {
+			runner.WarmPool.MaxSize = runner.WarmPool.MinSize
+		}
+
+		runner.WarmPool.MaxIdleAgeDuration = defaultWarmPoolMaxIdleAge
+		if runner.WarmPool.MaxIdleAge != "" {
+			// An invalid value is reported by validateWarmPool
+			runner.WarmPool.MaxIdleAgeDuration, _ = time.ParseDuration(runner.WarmPool.MaxIdleAge)
+		}
+	}
+}
+
+// ScaleSetLabels returns the labels the runner scale set of the runner registers: its name, its custom labels and the
+// labels that route jobs to other VM configs. Labels are case-insensitive, so duplicates are only returned once.
+func (r *Runner) ScaleSetLabels() []string {
+	labels := []string{}
+	seen := map[string]bool{}
+	add := func(label string) {
+		if !seen[strings.ToLower(label)] {
+			seen[strings.ToLower(label)] = true
+			labels = append(labels, label)
+		}
+	}
+
+	add(r.Name)
+	for _, label := range r.Labels {
+		add(label)
+	}
+	for _, labelVMConfig := range r.LabelVMConfigs {
+		for _, label := range labelVMConfig.Labels {
+			add(label)
+		}
+	}
+
+	return labels
+}
+
+// RunnerSlots returns how many runners of the scale set may exist at the same time. The VMs the warm pool can grow to
+// are reserved from maxRunners, so that they are counted against it. Zero means no limit.
+func (r *Runner) RunnerSlots() int {
+	if r.MaxRunners == 0 || r.WarmPool == nil {
+		return r.MaxRunners
+	}
+
+	return r.MaxRunners - r.WarmPool.MaxSize
+}
+
+// RunnerSlots returns how many runners may exist at the same time across all scale sets. The VMs the warm pools can
+// grow to are reserved from MAX_RUNNERS, so that they are counted against it. Zero means no limit.
+func (d *Data) RunnerSlots() int {
+	if d.MaxRunners == 0 {
+		return 0
+	}
+
+	slots := d.MaxRunners
+	for _, runner := range d.Runners {
+		if runner.WarmPool != nil {
+			slots -= runner.WarmPool.MaxSize
+		}
+	}
+
+	return slots
+}
+
+// Namespaces returns the distinct Orka namespaces used by the configured runners.
+func (d *Data) Namespaces() []string {
+	namespaces := []string{}
+	seen := map[string]bool{}
+	for _, runner := range d.Runners {
+		if !seen[runner.OrkaNamespace] {
+			seen[runner.OrkaNamespace] = true
+			namespaces = append(namespaces, runner.OrkaNamespace)
+		}
+	}
+
+	return namespaces
+}
+
+// loadHooks reads and parses the hook scripts.
+func loadHooks(paths []string) ([]*template.Template, error) {
+	hooks := []*template.Template{}
+	for _, path := range paths {
+		hook, err := loadTemplate(path)
+		if err != nil {
+			return nil, err
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, nil
+}
+
+// loadTemplate reads and parses a text/template file. The template is named after the file.
+func loadTemplate(path string) (*template.Template, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(content))
+}
+
+func parseSSHKey(key, passphrase string) (ssh.Signer, error) {
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase([]byte(key), []byte(passphrase))
+	}
+
+	return ssh.ParsePrivateKey([]byte(key))
+}
+
+// isLoopbackAddr reports whether a listen address such as `127.0.0.1:8090` only accepts local connections. An address
+// without a host listens on all interfaces.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validateMetadata checks the key=value comma separated metadata. Keys may contain dashes, dots and slashes, and values
+// may contain anything but commas, for example, the `ssh-host-key` metadata with a public key like `ssh-ed25519 AAAA...`.
 func validateMetadata(metadata string) bool {
-	r, _ := regexp.Compile(`^(\w+=\w+)(,\s*\w+=\w+)*$`)
+	r, _ := regexp.Compile(`^([\w./-]+=[^,]+)(,\s*[\w./-]+=[^,]+)*$`)
 	return r.MatchString(metadata)
 }
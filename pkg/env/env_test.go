@@ -2,6 +2,7 @@ package env
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -29,5 +30,275 @@ var _ = Describe("Env Test", func() {
 		Entry("with invalid string with empty key, should be invalid", "=value1", false),
 		Entry("with invalid string with empty value, should be invalid", "key1=", false),
 		Entry("with invalid string with no equals sign, should be invalid", "key1;value1", false),
+		Entry("with valid string with dashes in the key, should be valid", "ssh-host-key=SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s", true),
+		Entry("with valid string with a public key value, should be valid", "team=ios,ssh-host-key=ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl+/=", true),
 	)
+
+	Describe("when resolving runner settings", func() {
+		envData := &Data{
+			OrkaNamespace:  "orka-default",
+			OrkaVMConfig:   "default-config",
+			OrkaVMUsername: "admin",
+			OrkaVMPassword: "admin",
+			OrkaVMMetadata: "key=value",
+		}
+
+		It("should fall back to the global values", func() {
+			runner := Runner{Name: "runner"}
+			resolveRunner(&runner, envData)
+
+			Expect(runner.OrkaNamespace).To(Equal("orka-default"))
+			Expect(runner.OrkaVMConfig).To(Equal("default-config"))
+			Expect(runner.OrkaVMUsername).To(Equal("admin"))
+			Expect(runner.OrkaVMPassword).To(Equal("admin"))
+			Expect(runner.OrkaVMMetadata).To(Equal("key=value"))
+		})
+
+		It("should keep the runner overrides", func() {
+			runner := Runner{Name: "runner", OrkaNamespace: "orka-xcode16", OrkaVMConfig: "sequoia-xcode16", OrkaVMUsername: "builder"}
+			resolveRunner(&runner, envData)
+
+			Expect(runner.OrkaNamespace).To(Equal("orka-xcode16"))
+			Expect(runner.OrkaVMConfig).To(Equal("sequoia-xcode16"))
+			Expect(runner.OrkaVMUsername).To(Equal("builder"))
+			Expect(runner.OrkaVMPassword).To(Equal("admin"))
+		})
+	})
+
+	Describe("when deriving the default controller ID", func() {
+		It("should not change across restarts", func() {
+			Expect(DefaultControllerId("https://github.com/org")).To(Equal(DefaultControllerId("https://github.com/org/")))
+			Expect(DefaultControllerId("https://github.com/org")).To(Equal(DefaultControllerId("https://github.com/ORG")))
+			Expect(DefaultControllerId("https://github.com/org")).To(HavePrefix("orka-github-runner-"))
+		})
+
+		It("should differ between GitHub URLs", func() {
+			Expect(DefaultControllerId("https://github.com/org")).NotTo(Equal(DefaultControllerId("https://github.com/other")))
+		})
+	})
+
+	Describe("when validating the GitHub authentication", func() {
+		envData := func(gitHubURL, pat string) *Data {
+			return &Data{
+				GitHubURL:         gitHubURL,
+				GitHubPAT:         pat,
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				Runners:           []Runner{{Name: "runner", OrkaVMConfig: "config"}},
+			}
+		}
+
+		It("should require a personal access token for enterprise URLs", func() {
+			Expect(validateEnv(envData("https://github.com/enterprises/acme", ""))).To(ContainElement(ContainSubstring(GitHubPATEnvName)))
+			Expect(validateEnv(envData("https://github.com/enterprises/acme", "ghp_token"))).NotTo(ContainElement(ContainSubstring(GitHubPATEnvName)))
+		})
+
+		It("should not require a personal access token for organization URLs", func() {
+			Expect(validateEnv(envData("https://github.com/org", ""))).NotTo(ContainElement(ContainSubstring(GitHubPATEnvName)))
+		})
+	})
+
+	Describe("when validating runner limits", func() {
+		It("should reject minRunners above maxRunners", func() {
+			envData := &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				Runners:           []Runner{{Name: "runner", OrkaVMConfig: "config", MinRunners: 3, MaxRunners: 2}},
+			}
+
+			Expect(validateEnv(envData)).To(ContainElement(ContainSubstring("minRunners of runner runner")))
+		})
+
+		It("should reserve the warm pool VMs from the runner limits", func() {
+			envData := &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				MaxRunners:        20,
+				Runners: []Runner{
+					{Name: "runner", OrkaVMConfig: "config", MaxRunners: 10, WarmPool: &WarmPool{MinSize: 2, MaxSize: 4, MaxIdleAgeDuration: time.Hour}},
+					{Name: "other", OrkaVMConfig: "config", WarmPool: &WarmPool{MinSize: 1, MaxSize: 3, MaxIdleAgeDuration: time.Hour}},
+					{Name: "plain", OrkaVMConfig: "config", MaxRunners: 5},
+				},
+			}
+
+			errors := validateEnv(envData)
+			Expect(errors).NotTo(ContainElement(ContainSubstring("warmPool")))
+			Expect(errors).NotTo(ContainElement(ContainSubstring(MaxRunnersEnvName)))
+			Expect(envData.RunnerSlots()).To(Equal(13))
+			Expect(envData.Runners[0].RunnerSlots()).To(Equal(6))
+			Expect(envData.Runners[1].RunnerSlots()).To(BeZero())
+			Expect(envData.Runners[2].RunnerSlots()).To(Equal(5))
+
+			envData.MaxRunners = 0
+			Expect(envData.RunnerSlots()).To(BeZero())
+		})
+
+		It("should reject a warm pool that does not fit into maxRunners", func() {
+			envData := &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				Runners:           []Runner{{Name: "runner", OrkaVMConfig: "config", MaxRunners: 4, WarmPool: &WarmPool{MinSize: 2, MaxSize: 4, MaxIdleAgeDuration: time.Hour}}},
+			}
+
+			Expect(validateEnv(envData)).To(ContainElement(ContainSubstring("maxRunners of runner runner must be greater than its warmPool max")))
+		})
+
+		It("should reject warm pools that do not fit into MAX_RUNNERS", func() {
+			envData := &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				MaxRunners:        5,
+				Runners: []Runner{
+					{Name: "runner", OrkaVMConfig: "config", WarmPool: &WarmPool{MinSize: 2, MaxSize: 3, MaxIdleAgeDuration: time.Hour}},
+					{Name: "other", OrkaVMConfig: "config", WarmPool: &WarmPool{MinSize: 2, MaxSize: 2, MaxIdleAgeDuration: time.Hour}},
+				},
+			}
+
+			Expect(validateEnv(envData)).To(ContainElement(ContainSubstring(MaxRunnersEnvName)))
+		})
+
+		It("should reject a runner group name combined with an id", func() {
+			envData := &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				Runners:           []Runner{{Name: "runner", OrkaVMConfig: "config", Id: 3, Group: "macOS"}},
+			}
+
+			Expect(validateEnv(envData)).To(ContainElement(ContainSubstring("both a group and an id")))
+		})
+
+		It("should only allow repositories for runner groups with the selected visibility", func() {
+			envData := &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				Runners: []Runner{
+					{Name: "runner", OrkaVMConfig: "config", Group: "macOS", CreateGroup: &RunnerGroupSettings{Visibility: "all", Repositories: []string{"app"}}},
+					{Name: "other", OrkaVMConfig: "config", Group: "iOS", CreateGroup: &RunnerGroupSettings{Visibility: "selected", Repositories: []string{"app"}}},
+				},
+			}
+
+			errors := validateEnv(envData)
+			Expect(errors).To(ContainElement(ContainSubstring("createGroup repositories of runner runner")))
+			Expect(errors).NotTo(ContainElement(ContainSubstring("of runner other")))
+		})
+
+		It("should reject a GitHub API rate limit without bursts", func() {
+			envData := &Data{
+				GitHubURL:               "https://github.com/org",
+				OrkaURL:                 "http://10.221.188.20",
+				OrkaToken:               "token",
+				OrkaClientBackend:       "api",
+				Runners:                 []Runner{{Name: "runner", OrkaVMConfig: "config"}},
+				GitHubAPIRateLimit:      4000,
+				GitHubAPIRateLimitBurst: 0,
+			}
+
+			Expect(validateEnv(envData)).To(ContainElement(ContainSubstring(GitHubAPIRateLimitBurstEnvName)))
+		})
+
+		It("should reject a negative drain timeout", func() {
+			envData := &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				Runners:           []Runner{{Name: "runner", OrkaVMConfig: "config"}},
+				DrainTimeout:      -time.Second,
+			}
+
+			Expect(validateEnv(envData)).To(ContainElement(ContainSubstring(DrainTimeoutEnvName)))
+		})
+	})
+
+	Describe("when validating the admin API", func() {
+		envData := func(addr, token string) *Data {
+			return &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				Runners:           []Runner{{Name: "runner", OrkaVMConfig: "config"}},
+				EnableAdminAPI:    true,
+				AdminAPIAddr:      addr,
+				AdminAPIToken:     token,
+			}
+		}
+
+		It("should require a token when the admin API is exposed", func() {
+			Expect(validateEnv(envData(":8090", ""))).To(ContainElement(ContainSubstring(AdminAPITokenEnvName)))
+			Expect(validateEnv(envData("0.0.0.0:8090", ""))).To(ContainElement(ContainSubstring(AdminAPITokenEnvName)))
+			Expect(validateEnv(envData(":8090", "secret"))).NotTo(ContainElement(ContainSubstring(AdminAPITokenEnvName)))
+		})
+
+		It("should not require a token on a loopback address", func() {
+			Expect(validateEnv(envData("127.0.0.1:8090", ""))).NotTo(ContainElement(ContainSubstring(AdminAPITokenEnvName)))
+			Expect(validateEnv(envData("localhost:8090", ""))).NotTo(ContainElement(ContainSubstring(AdminAPITokenEnvName)))
+			Expect(validateEnv(envData("[::1]:8090", ""))).NotTo(ContainElement(ContainSubstring(AdminAPITokenEnvName)))
+		})
+	})
+
+	Describe("when routing jobs to VM configs by label", func() {
+		It("should register the custom and routing labels with the scale set once", func() {
+			runner := Runner{Name: "runner", Labels: []string{"macOS", "arm64", "XCode-16"}, LabelVMConfigs: []LabelVMConfig{
+				{Labels: []string{"xcode-16"}, VMConfig: "sonoma-xcode16"},
+				{Labels: []string{"xcode-16", "arm64-large"}, VMConfig: "large-config"},
+				{Labels: []string{"Runner"}, VMConfig: "default-config"},
+			}}
+
+			Expect(runner.ScaleSetLabels()).To(Equal([]string{"runner", "macOS", "arm64", "XCode-16", "arm64-large"}))
+		})
+
+		It("should reject an empty custom label", func() {
+			envData := &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				Runners:           []Runner{{Name: "runner", OrkaVMConfig: "config", Labels: []string{"macOS", " "}}},
+			}
+
+			Expect(validateEnv(envData)).To(ContainElement(ContainSubstring("labels of runner runner")))
+		})
+
+		It("should reject idle runners together with routing rules", func() {
+			envData := &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				Runners: []Runner{{Name: "runner", OrkaVMConfig: "config", MinRunners: 2, LabelVMConfigs: []LabelVMConfig{
+					{Labels: []string{"xcode-16"}, VMConfig: "sonoma-xcode16"},
+				}}},
+			}
+
+			Expect(validateEnv(envData)).To(ContainElement(ContainSubstring("must not set minRunners together with labelVMConfigs")))
+		})
+
+		It("should reject a rule without labels", func() {
+			envData := &Data{
+				GitHubURL:         "https://github.com/org",
+				OrkaURL:           "http://10.221.188.20",
+				OrkaToken:         "token",
+				OrkaClientBackend: "api",
+				Runners: []Runner{{Name: "runner", OrkaVMConfig: "config", LabelVMConfigs: []LabelVMConfig{
+					{VMConfig: "sonoma-xcode16"},
+				}}},
+			}
+
+			Expect(validateEnv(envData)).To(ContainElement(ContainSubstring("labelVMConfigs entry of runner runner")))
+		})
+	})
 })
@@ -17,11 +17,11 @@ import (
 	"github.com/google/uuid"
 	"github.com/macstadium/orka-github-actions-integration/pkg/env"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github"
-	"github.com/macstadium/orka-github-actions-integration/pkg/github/app"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/auth"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
 	retryablehttp "github.com/macstadium/orka-github-actions-integration/pkg/http"
 	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
 	"github.com/macstadium/orka-github-actions-integration/pkg/utils"
 	"go.uber.org/zap"
 )
@@ -34,6 +34,7 @@ const (
 type ActionsService interface {
 	GetRunnerScaleSet(ctx context.Context, runnerGroupId int, runnerScaleSetName string) (*types.RunnerScaleSet, error)
 	CreateRunnerScaleSet(ctx context.Context, runnerScaleSet *types.RunnerScaleSet) (*types.RunnerScaleSet, error)
+	UpdateRunnerScaleSet(ctx context.Context, runnerScaleSetId int, runnerScaleSet *types.RunnerScaleSet) (*types.RunnerScaleSet, error)
 	DeleteRunnerScaleSet(ctx context.Context, runnerScaleSetId int) error
 
 	GetRunner(ctx context.Context, runnerName string) (*types.RunnerReference, error)
@@ -66,6 +67,10 @@ type ActionsClient struct {
 
 	// lock for refreshing the adminToken and adminTokenExpiresAt
 	mu sync.Mutex
+
+	// tokenRefreshErr has its own lock, so that the health checks can read it while a refresh holds mu
+	tokenRefreshErr   error
+	tokenRefreshErrMu sync.Mutex
 }
 
 func (client *ActionsClient) newActionsServiceRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
@@ -90,11 +95,35 @@ func (client *ActionsClient) updateTokenIfNeeded(ctx context.Context) error {
 		return nil
 	}
 
+	err := client.refreshToken(ctx)
+	if err != nil {
+		metrics.TokenRefreshes.WithLabelValues(metrics.ResultFailure).Inc()
+	} else {
+		metrics.TokenRefreshes.WithLabelValues(metrics.ResultSuccess).Inc()
+	}
+
+	client.tokenRefreshErrMu.Lock()
+	client.tokenRefreshErr = err
+	client.tokenRefreshErrMu.Unlock()
+
+	return err
+}
+
+// CheckToken returns the error of the last token refresh. The token is only refreshed when a request needs it, so an
+// expired token is not an error by itself. It does not wait for a refresh that is in progress.
+func (client *ActionsClient) CheckToken() error {
+	client.tokenRefreshErrMu.Lock()
+	defer client.tokenRefreshErrMu.Unlock()
+
+	return client.tokenRefreshErr
+}
+
+func (client *ActionsClient) refreshToken(ctx context.Context) error {
 	client.logger.Infof("refreshing token for githubConfigUrl %s", client.gitHubConfig.URL)
 
-	accessToken, err := app.FetchAccessToken(ctx, client.envData)
+	accessToken, err := auth.FetchAccessToken(ctx, client.envData)
 	if err != nil {
-		return fmt.Errorf("failed to get app access token on refresh: %w", err)
+		return fmt.Errorf("failed to get access token on refresh: %w", err)
 	}
 
 	authInfo, err := auth.GetAuthorizationInfo(ctx, accessToken, client.envData.GitHubAPIUrl, client.gitHubConfig)
@@ -135,9 +164,9 @@ func (client *ActionsClient) buildURL(path, apiVersion string) (*url.URL, error)
 }
 
 func NewActionsClient(ctx context.Context, envData *env.Data, config *github.GitHubConfig) (*ActionsClient, error) {
-	accessToken, err := app.FetchAccessToken(ctx, envData)
+	accessToken, err := auth.FetchAccessToken(ctx, envData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get access token from app: %w", err)
+		return nil, fmt.Errorf("failed to get access token: %w", err)
 	}
 
 	authInfo, err := auth.GetAuthorizationInfo(ctx, accessToken, envData.GitHubAPIUrl, config)
@@ -0,0 +1,29 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestActions(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Actions Suite")
+}
+
+var _ = Describe("ActionsClient", func() {
+	It("should report the last token refresh error while a refresh is in progress", func() {
+		client := &ActionsClient{}
+		client.tokenRefreshErr = errors.New("failed to get access token on refresh")
+
+		client.mu.Lock()
+		defer client.mu.Unlock()
+
+		done := make(chan error, 1)
+		go func() { done <- client.CheckToken() }()
+
+		Eventually(done).Should(Receive(MatchError("failed to get access token on refresh")))
+	})
+})
@@ -35,6 +35,12 @@ func (client *ActionsClient) CreateRunnerScaleSet(ctx context.Context, runner *t
 	return RequestJSON[types.RunnerScaleSet, types.RunnerScaleSet](ctx, client, http.MethodPost, scaleSetEndpoint, runner)
 }
 
+func (client *ActionsClient) UpdateRunnerScaleSet(ctx context.Context, runnerScaleSetId int, runner *types.RunnerScaleSet) (*types.RunnerScaleSet, error) {
+	path := fmt.Sprintf("/%s/%d", scaleSetEndpoint, runnerScaleSetId)
+
+	return RequestJSON[types.RunnerScaleSet, types.RunnerScaleSet](ctx, client, http.MethodPatch, path, runner)
+}
+
 func (client *ActionsClient) DeleteRunnerScaleSet(ctx context.Context, runnerScaleSetId int) error {
 	path := fmt.Sprintf("/%s/%d", scaleSetEndpoint, runnerScaleSetId)
 
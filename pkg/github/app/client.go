@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -16,10 +17,16 @@ import (
 	"github.com/macstadium/orka-github-actions-integration/pkg/env"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
 	retryablehttp "github.com/macstadium/orka-github-actions-integration/pkg/http"
+	"github.com/macstadium/orka-github-actions-integration/pkg/utils"
 )
 
 func FetchAccessToken(ctx context.Context, envData *env.Data) (*types.AccessToken, error) {
-	accessTokenJWT, err := createJWTForGitHubApp(envData.GitHubAppID, envData.GitHubAppPrivateKey)
+	privateKeyContent, err := readPrivateKey(envData)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenJWT, err := createJWTForGitHubApp(envData.GitHubAppID, privateKeyContent, envData.GitHubAppPrivateKeyPassphrase)
 	if err != nil {
 		return nil, err
 	}
@@ -37,7 +44,22 @@ func FetchAccessToken(ctx context.Context, envData *env.Data) (*types.AccessToke
 	return api.RequestJSON[any, types.AccessToken](ctx, httpClient.Client, http.MethodPost, path, nil)
 }
 
-func createJWTForGitHubApp(appID int64, privateKeyContent string) (string, error) {
+// readPrivateKey returns the private key of the GitHub App. A key file is read on every call, so that a rotated key, for
+// example, in a mounted Kubernetes secret, is used for the next token.
+func readPrivateKey(envData *env.Data) (string, error) {
+	if envData.GitHubAppPrivateKeyPath == "" {
+		return envData.GitHubAppPrivateKey, nil
+	}
+
+	privateKeyContent, err := os.ReadFile(envData.GitHubAppPrivateKeyPath)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the GitHub App private key: %w", err)
+	}
+
+	return string(privateKeyContent), nil
+}
+
+func createJWTForGitHubApp(appID int64, privateKeyContent, passphrase string) (string, error) {
 	// Encode as JWT
 	// See https://docs.github.com/en/developers/apps/building-github-apps/authenticating-with-github-apps#authenticating-as-a-github-app
 
@@ -53,9 +75,9 @@ func createJWTForGitHubApp(appID int64, privateKeyContent string) (string, error
 
 	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
 
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKeyContent))
+	privateKey, err := utils.ParseRSAPrivateKey([]byte(privateKeyContent), passphrase)
 	if err != nil {
-		return "", fmt.Errorf("error parsing PKCS#1 RSA private key: %v", err)
+		return "", fmt.Errorf("error parsing the GitHub App private key: %w", err)
 	}
 
 	return token.SignedString(privateKey)
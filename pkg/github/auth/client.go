@@ -49,6 +49,10 @@ func createRegistrationTokenPath(githubApiUrl string, config *github.GitHubConfi
 		path := fmt.Sprintf("%s/repos/%s/%s/actions/runners/registration-token", githubApiUrl, config.Organization, config.Repository)
 		return path, nil
 
+	case github.GitHubScopeEnterprise:
+		path := fmt.Sprintf("%s/enterprises/%s/actions/runners/registration-token", githubApiUrl, config.Enterprise)
+		return path, nil
+
 	default:
 		return "", fmt.Errorf("unknown scope for config url: %s", config.URL)
 	}
@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/env"
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/app"
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
+)
+
+// FetchAccessToken returns the token that authenticates with the GitHub API: the personal access token when one is
+// configured, or a new installation access token of the GitHub App otherwise.
+func FetchAccessToken(ctx context.Context, envData *env.Data) (*types.AccessToken, error) {
+	if envData.GitHubPAT != "" {
+		return &types.AccessToken{Token: envData.GitHubPAT}, nil
+	}
+
+	return app.FetchAccessToken(ctx, envData)
+}
@@ -12,6 +12,7 @@ import (
 
 type GitHubConfig struct {
 	Scope        GitHubScope
+	Enterprise   string
 	Organization string
 	Repository   string
 	URL          string
@@ -23,9 +24,10 @@ const (
 	GitHubScopeUnknown GitHubScope = iota
 	GitHubScopeOrganization
 	GitHubScopeRepository
+	GitHubScopeEnterprise
 )
 
-var ErrInvalidGitHubConfigURL = fmt.Errorf("invalid config URL, should point to an organization or repository")
+var ErrInvalidGitHubConfigURL = fmt.Errorf("invalid config URL, should point to an enterprise, organization or repository")
 
 func NewGitHubConfig(gitHubURL string) (*GitHubConfig, error) {
 	u, err := url.Parse(strings.Trim(gitHubURL, "/"))
@@ -50,7 +52,14 @@ func NewGitHubConfig(gitHubURL string) (*GitHubConfig, error) {
 		config.Scope = GitHubScopeOrganization
 		config.Organization = pathParts[0]
 
-	case 2: // Repository
+	case 2:
+		if pathParts[0] == "enterprises" { // Enterprise
+			config.Scope = GitHubScopeEnterprise
+			config.Enterprise = pathParts[1]
+			break
+		}
+
+		// Repository
 		config.Scope = GitHubScopeRepository
 		config.Organization = pathParts[0]
 		config.Repository = pathParts[1]
@@ -60,6 +60,20 @@ var _ = Describe("GitHub Config", func() {
 					Repository:   "",
 				},
 			},
+			{
+				configURL: "https://github.com/enterprises/acme",
+				expected: &github.GitHubConfig{
+					Scope:      github.GitHubScopeEnterprise,
+					Enterprise: "acme",
+				},
+			},
+			{
+				configURL: "https://ghes.example.com/enterprises/acme/",
+				expected: &github.GitHubConfig{
+					Scope:      github.GitHubScopeEnterprise,
+					Enterprise: "acme",
+				},
+			},
 			{
 				configURL: "https://github.localhost/org",
 				expected: &github.GitHubConfig{
@@ -77,6 +91,7 @@ var _ = Describe("GitHub Config", func() {
 				Expect(err).To(BeNil())
 
 				Expect(config.Scope).To(Equal(test.expected.Scope))
+				Expect(config.Enterprise).To(Equal(test.expected.Enterprise))
 				Expect(config.Organization).To(Equal(test.expected.Organization))
 				Expect(config.Repository).To(Equal(test.expected.Repository))
 			})
@@ -93,7 +108,7 @@ var _ = Describe("GitHub Config", func() {
 				config, err := github.NewGitHubConfig(invalidURL)
 
 				Expect(config).To(BeNil())
-				Expect(err.Error()).To(Equal(fmt.Sprintf("%q: invalid config URL, should point to an organization or repository", strings.Trim(invalidURL, "/"))))
+				Expect(err.Error()).To(Equal(fmt.Sprintf("%q: invalid config URL, should point to an enterprise, organization or repository", strings.Trim(invalidURL, "/"))))
 			})
 		}
 	})
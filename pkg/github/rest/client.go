@@ -0,0 +1,46 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/env"
+	"github.com/macstadium/orka-github-actions-integration/pkg/github"
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/auth"
+	retryablehttp "github.com/macstadium/orka-github-actions-integration/pkg/http"
+)
+
+// Client calls the GitHub REST API with the GitHub App installation or the personal access token. It is meant for the
+// short-lived calls at startup, so its access token is not refreshed.
+type Client struct {
+	httpClient *http.Client
+	apiURL     string
+	config     *github.GitHubConfig
+}
+
+func NewClient(ctx context.Context, envData *env.Data, config *github.GitHubConfig) (*Client, error) {
+	accessToken, err := auth.FetchAccessToken(ctx, envData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	return newClient(envData.GitHubAPIUrl, accessToken.Token, config)
+}
+
+func newClient(apiURL, token string, config *github.GitHubConfig) (*Client, error) {
+	retryableClient, err := retryablehttp.NewClient(&retryablehttp.ClientTransport{
+		Token:       token,
+		ContentType: "application/json",
+		Accept:      "application/vnd.github+json",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		httpClient: retryableClient.Client,
+		apiURL:     apiURL,
+		config:     config,
+	}, nil
+}
@@ -0,0 +1,92 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/api"
+	"github.com/macstadium/orka-github-actions-integration/pkg/github"
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
+)
+
+const runnerGroupsPageSize = 100
+
+// ErrRunnerGroupsUnsupported is returned for GitHub URLs that do not have runner groups, such as repositories.
+var ErrRunnerGroupsUnsupported = errors.New("runner groups are only available for organizations and enterprises")
+
+// GetRunnerGroup returns the runner group with the name, or nil if the organization or enterprise does not have one.
+// Names are compared case-insensitively, like GitHub does.
+func (c *Client) GetRunnerGroup(ctx context.Context, name string) (*types.RunnerGroup, error) {
+	path, err := c.runnerGroupsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	for page := 1; ; page++ {
+		list, err := api.RequestJSON[any, types.RunnerGroupList](ctx, c.httpClient, http.MethodGet, fmt.Sprintf("%s?per_page=%d&page=%d", path, runnerGroupsPageSize, page), nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list runner groups: %w", err)
+		}
+
+		for _, group := range list.RunnerGroups {
+			if strings.EqualFold(group.Name, name) {
+				return &group, nil
+			}
+		}
+
+		if len(list.RunnerGroups) < runnerGroupsPageSize || page*runnerGroupsPageSize >= list.TotalCount {
+			return nil, nil
+		}
+	}
+}
+
+// CreateRunnerGroup creates a runner group with the visibility. The repositories are the names of the repositories of
+// the organization that may use the group when the visibility is `selected`. Enterprise runner groups are available to
+// the organizations of the enterprise, so they cannot select repositories.
+func (c *Client) CreateRunnerGroup(ctx context.Context, name, visibility string, repositories []string) (*types.RunnerGroup, error) {
+	path, err := c.runnerGroupsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.config.Scope == github.GitHubScopeEnterprise && len(repositories) > 0 {
+		return nil, fmt.Errorf("unable to create runner group %s: enterprise runner groups cannot select repositories", name)
+	}
+
+	request := &types.CreateRunnerGroupRequest{
+		Name:       name,
+		Visibility: visibility,
+	}
+
+	for _, repository := range repositories {
+		repo, err := api.RequestJSON[any, types.Repository](ctx, c.httpClient, http.MethodGet, fmt.Sprintf("%s/repos/%s/%s", c.apiURL, url.PathEscape(c.config.Organization), url.PathEscape(repository)), nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to look up repository %s/%s: %w", c.config.Organization, repository, err)
+		}
+		request.SelectedRepositoryIds = append(request.SelectedRepositoryIds, repo.Id)
+	}
+
+	group, err := api.RequestJSON[types.CreateRunnerGroupRequest, types.RunnerGroup](ctx, c.httpClient, http.MethodPost, path, request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create runner group %s: %w", name, err)
+	}
+
+	return group, nil
+}
+
+func (c *Client) runnerGroupsPath() (string, error) {
+	switch c.config.Scope {
+	case github.GitHubScopeOrganization:
+		return fmt.Sprintf("%s/orgs/%s/actions/runner-groups", c.apiURL, url.PathEscape(c.config.Organization)), nil
+
+	case github.GitHubScopeEnterprise:
+		return fmt.Sprintf("%s/enterprises/%s/actions/runner-groups", c.apiURL, url.PathEscape(c.config.Enterprise)), nil
+
+	default:
+		return "", fmt.Errorf("%w: %s", ErrRunnerGroupsUnsupported, c.config.URL)
+	}
+}
@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/github"
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
+	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "GitHub REST Suite")
+}
+
+var _ = Describe("Runner groups", func() {
+	var (
+		server  *httptest.Server
+		mux     *http.ServeMux
+		client  *Client
+		created *types.CreateRunnerGroupRequest
+	)
+
+	writeJSON := func(w http.ResponseWriter, body any) {
+		w.Header().Set("Content-Type", "application/json")
+		Expect(json.NewEncoder(w).Encode(body)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		logging.SetupLogger("info")
+		created = nil
+
+		mux = http.NewServeMux()
+		mux.HandleFunc("GET /orgs/acme/actions/runner-groups", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer token"))
+
+			groups := []types.RunnerGroup{}
+			if r.URL.Query().Get("page") == "1" {
+				for i := 1; i <= runnerGroupsPageSize; i++ {
+					groups = append(groups, types.RunnerGroup{Id: i, Name: fmt.Sprintf("group-%d", i)})
+				}
+			} else {
+				groups = append(groups, types.RunnerGroup{Id: 101, Name: "macOS"})
+			}
+			writeJSON(w, types.RunnerGroupList{TotalCount: runnerGroupsPageSize + 1, RunnerGroups: groups})
+		})
+		mux.HandleFunc("GET /repos/acme/app", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, types.Repository{Id: 42, FullName: "acme/app"})
+		})
+		mux.HandleFunc("POST /orgs/acme/actions/runner-groups", func(w http.ResponseWriter, r *http.Request) {
+			created = &types.CreateRunnerGroupRequest{}
+			Expect(json.NewDecoder(r.Body).Decode(created)).To(Succeed())
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(w, types.RunnerGroup{Id: 102, Name: created.Name, Visibility: created.Visibility})
+		})
+
+		server = httptest.NewServer(mux)
+		DeferCleanup(server.Close)
+
+		var err error
+		client, err = newClient(server.URL, "token", &github.GitHubConfig{Scope: github.GitHubScopeOrganization, Organization: "acme"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should find a runner group by name across pages", func() {
+		group, err := client.GetRunnerGroup(context.Background(), "macos")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(group.Id).To(Equal(101))
+	})
+
+	It("should return nil for a missing runner group", func() {
+		group, err := client.GetRunnerGroup(context.Background(), "linux")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(group).To(BeNil())
+	})
+
+	It("should create a runner group for the selected repositories", func() {
+		group, err := client.CreateRunnerGroup(context.Background(), "ios", "selected", []string{"app"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(group.Id).To(Equal(102))
+		Expect(created).To(Equal(&types.CreateRunnerGroupRequest{Name: "ios", Visibility: "selected", SelectedRepositoryIds: []int{42}}))
+	})
+
+	It("should look up enterprise runner groups", func() {
+		mux.HandleFunc("GET /enterprises/acme/actions/runner-groups", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, types.RunnerGroupList{TotalCount: 1, RunnerGroups: []types.RunnerGroup{{Id: 7, Name: "macOS"}}})
+		})
+		client.config = &github.GitHubConfig{Scope: github.GitHubScopeEnterprise, Enterprise: "acme"}
+
+		group, err := client.GetRunnerGroup(context.Background(), "macOS")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(group.Id).To(Equal(7))
+	})
+
+	It("should reject repository URLs", func() {
+		client.config = &github.GitHubConfig{Scope: github.GitHubScopeRepository, Organization: "acme", Repository: "app"}
+
+		_, err := client.GetRunnerGroup(context.Background(), "macOS")
+		Expect(err).To(MatchError(ErrRunnerGroupsUnsupported))
+	})
+})
@@ -36,6 +36,7 @@ func NewRunnerManager(ctx context.Context, client actions.ActionsService, runner
 		logger:           logger,
 		runnerScaleSetId: runnerScaleSetId,
 		actionsClient:    client,
+		lastPollAt:       time.Now(),
 	}
 
 	session, err := createSessionWithRetry(ctx, logger, client, runnerScaleSetId)
@@ -127,9 +128,45 @@ func (m *RunnerManager) getInitialMessage(ctx context.Context, session *types.Ru
 
 func (m *RunnerManager) Close() error {
 	m.logger.Infof("closing message queue for runner %d", m.runnerScaleSetId)
+
+	m.pollMutex.Lock()
+	m.closed = true
+	m.pollMutex.Unlock()
+
 	return m.messageQueueManager.Close()
 }
 
+// LastPoll returns when the message queue was last polled successfully, or when the session was created if it has
+// not been polled yet.
+func (m *RunnerManager) LastPoll() time.Time {
+	m.pollMutex.Lock()
+	defer m.pollMutex.Unlock()
+
+	return m.lastPollAt
+}
+
+// CheckSession returns an error when the message session is closed or the last poll of the message queue failed.
+func (m *RunnerManager) CheckSession() error {
+	m.pollMutex.Lock()
+	defer m.pollMutex.Unlock()
+
+	if m.closed {
+		return fmt.Errorf("message session of runner scale set %d is closed", m.runnerScaleSetId)
+	}
+
+	return m.lastPollErr
+}
+
+func (m *RunnerManager) recordPoll(err error) {
+	m.pollMutex.Lock()
+	defer m.pollMutex.Unlock()
+
+	m.lastPollErr = err
+	if err == nil {
+		m.lastPollAt = time.Now()
+	}
+}
+
 func (m *RunnerManager) ProcessMessages(ctx context.Context, handler func(msg *types.RunnerScaleSetMessage) error) error {
 	if m.initialMessage != nil {
 		err := handler(m.initialMessage)
@@ -149,6 +186,7 @@ func (m *RunnerManager) ProcessMessages(ctx context.Context, handler func(msg *t
 			}
 			m.logger.Errorf("unable to get the next message from the message queue. %w", err)
 		}
+		m.recordPoll(err)
 
 		if message == nil {
 			continue
@@ -0,0 +1,123 @@
+package runners
+
+import (
+	"context"
+	"time"
+)
+
+const drainPollInterval = time.Second
+
+// Name returns the name of the runner scale set the processor handles.
+func (p *RunnerMessageProcessor) Name() string {
+	return p.runnerScaleSetName
+}
+
+// Pause stops receiving messages after the message that is currently processed. Running jobs are not affected.
+func (p *RunnerMessageProcessor) Pause() {
+	p.pauseMutex.Lock()
+	defer p.pauseMutex.Unlock()
+
+	if p.paused {
+		return
+	}
+
+	p.logger.Infof("pausing message processing for %s", p.runnerScaleSetName)
+	p.paused = true
+	p.resumed = make(chan struct{})
+}
+
+// Resume restarts message processing and stops draining.
+func (p *RunnerMessageProcessor) Resume() {
+	p.pauseMutex.Lock()
+	defer p.pauseMutex.Unlock()
+
+	if p.draining.Swap(false) {
+		p.logger.Infof("stopped draining %s", p.runnerScaleSetName)
+	}
+
+	if !p.paused {
+		return
+	}
+
+	p.logger.Infof("resuming message processing for %s", p.runnerScaleSetName)
+	p.paused = false
+	p.resumedAt = time.Now()
+	close(p.resumed)
+}
+
+func (p *RunnerMessageProcessor) Paused() bool {
+	p.pauseMutex.Lock()
+	defer p.pauseMutex.Unlock()
+
+	return p.paused
+}
+
+// Drain stops acquiring new jobs and removes the idle runners that have not picked up a job. Jobs that are already
+// assigned to the scale set are still provisioned.
+func (p *RunnerMessageProcessor) Drain() {
+	if !p.draining.Swap(true) {
+		p.logger.Infof("draining %s, no new jobs will be acquired", p.runnerScaleSetName)
+	}
+
+	p.idleRunnersMutex.Lock()
+	idleRunners := make([]string, 0, len(p.idleRunners))
+	for runnerName := range p.idleRunners {
+		idleRunners = append(idleRunners, runnerName)
+	}
+	p.idleRunnersMutex.Unlock()
+
+	for _, runnerName := range idleRunners {
+		p.cancelRunnerContext(runnerName, "drain")
+	}
+}
+
+func (p *RunnerMessageProcessor) Draining() bool {
+	return p.draining.Load()
+}
+
+// ActiveRunners returns the number of runners that are waiting for a slot, provisioning, running or cleaning up.
+func (p *RunnerMessageProcessor) ActiveRunners() int {
+	return int(p.activeRunners.Load())
+}
+
+// WaitForRunners blocks until no runners are active or the context is done.
+func (p *RunnerMessageProcessor) WaitForRunners(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for p.ActiveRunners() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// CancelRunner cancels the runner context of the VM, which de-registers the runner and deletes the VM.
+// It returns false when the processor has no runner with that name.
+func (p *RunnerMessageProcessor) CancelRunner(runnerName string) bool {
+	return p.cancelRunnerContext(runnerName, "admin API request")
+}
+
+// waitUntilResumed blocks while the processor is paused. It returns false when the processor context is done.
+func (p *RunnerMessageProcessor) waitUntilResumed() bool {
+	p.pauseMutex.Lock()
+	resumed := p.resumed
+	p.pauseMutex.Unlock()
+
+	select {
+	case <-resumed:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+func closedChannel() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
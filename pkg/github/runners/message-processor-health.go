@@ -0,0 +1,38 @@
+package runners
+
+import (
+	"fmt"
+	"time"
+)
+
+// CheckMessageLoop returns an error when the message queue has not been polled successfully within maxAge. A paused
+// processor does not poll, so it is only checked again once maxAge has passed after it was resumed.
+func (p *RunnerMessageProcessor) CheckMessageLoop(maxAge time.Duration) error {
+	p.pauseMutex.Lock()
+	paused, resumedAt := p.paused, p.resumedAt
+	p.pauseMutex.Unlock()
+
+	if paused {
+		return nil
+	}
+
+	lastPoll := p.runnerManager.LastPoll()
+	if resumedAt.After(lastPoll) {
+		lastPoll = resumedAt
+	}
+
+	if since := time.Since(lastPoll); since > maxAge {
+		return fmt.Errorf("message queue of %s was last polled %v ago", p.runnerScaleSetName, since.Round(time.Second))
+	}
+
+	return nil
+}
+
+// CheckSession returns an error when the processor has no working message session.
+func (p *RunnerMessageProcessor) CheckSession() error {
+	if err := p.runnerManager.CheckSession(); err != nil {
+		return fmt.Errorf("message session of %s is not working: %w", p.runnerScaleSetName, err)
+	}
+
+	return nil
+}
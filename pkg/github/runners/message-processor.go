@@ -15,7 +15,12 @@ import (
 
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
 	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
 	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+	"github.com/macstadium/orka-github-actions-integration/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -34,12 +39,20 @@ func newJobIdentity(jobId string, runnerRequestId int64) jobIdentity {
 	return jobIdentity{jobId: jobId, runnerRequestId: runnerRequestId}
 }
 
+// isIdleRunner reports whether the identity is empty, which is used for idle runners that are not provisioned for a job.
+func (k jobIdentity) isIdleRunner() bool {
+	return k == jobIdentity{}
+}
+
 func (k jobIdentity) String() string {
+	if k.isIdleRunner() {
+		return "idle runner"
+	}
 	return fmt.Sprintf("jobId=%s runnerRequestId=%d", k.jobId, k.runnerRequestId)
 }
 
-func NewRunnerMessageProcessor(ctx context.Context, runnerManager RunnerManagerInterface, runnerProvisioner RunnerProvisionerInterface, vmTracker *VMTracker, runnerScaleSet *types.RunnerScaleSet) *RunnerMessageProcessor {
-	return &RunnerMessageProcessor{
+func NewRunnerMessageProcessor(ctx context.Context, runnerManager RunnerManagerInterface, runnerProvisioner RunnerProvisionerInterface, vmTracker *VMTracker, runnerScaleSet *types.RunnerScaleSet, minRunners int) *RunnerMessageProcessor {
+	p := &RunnerMessageProcessor{
 		ctx:                       ctx,
 		runnerManager:             runnerManager,
 		runnerProvisioner:         runnerProvisioner,
@@ -49,8 +62,20 @@ func NewRunnerMessageProcessor(ctx context.Context, runnerManager RunnerManagerI
 		upstreamCanceledJobsMutex: sync.RWMutex{},
 		runnerContextCancels:      map[string]context.CancelFunc{},
 		runnerContextCancelsMutex: sync.Mutex{},
+		runnerSessions:            map[string]chan struct{}{},
 		vmTracker:                 vmTracker,
+		minRunners:                minRunners,
+		idleRunners:               map[string]bool{},
+		resumed:                   closedChannel(),
 	}
+
+	// Runners whose VM the tracker deleted never get a job completed message, for example, adopted runners and runners
+	// whose SSH session dropped, so their context has to be canceled to release their runner slot.
+	vmTracker.OnDeleted(func(vmName string) {
+		p.cancelRunnerContext(vmName, "VM tracker deleted the orphaned VM")
+	})
+
+	return p
 }
 
 func (p *RunnerMessageProcessor) StartProcessingMessages() error {
@@ -61,6 +86,10 @@ func (p *RunnerMessageProcessor) StartProcessingMessages() error {
 			p.logger.Infof("message processing service is stopped for runner %s", p.runnerScaleSetName)
 			return nil
 		default:
+			if !p.waitUntilResumed() {
+				continue
+			}
+
 			err := p.runnerManager.ProcessMessages(p.ctx, p.processRunnerMessage)
 			if err != nil {
 				return fmt.Errorf("could not get and process message. %w", err)
@@ -86,6 +115,8 @@ func (p *RunnerMessageProcessor) processRunnerMessage(message *types.RunnerScale
 		message.Statistics.TotalIdleRunners,
 	)
 
+	p.ensureMinRunners()
+
 	if message.MessageType != runnerScaleSetJobMessagesType {
 		p.logger.Infof("skip message with unknown message type %s", message.MessageType)
 		return nil
@@ -127,6 +158,8 @@ func (p *RunnerMessageProcessor) processRunnerMessage(message *types.RunnerScale
 			}
 
 			p.logger.Infof("Job assigned message received for JobId: %s, RunnerRequestId: %d", jobAssigned.JobId, jobAssigned.RunnerRequestId)
+			_, assignedSpan := tracing.StartJobSpan(p.ctx, jobAssigned.RunnerRequestId, "JobAssigned", tracing.JobIdKey.String(jobAssigned.JobId), tracing.ScaleSetKey.String(p.runnerScaleSetName))
+			assignedSpan.End()
 
 			if provisionedRunners < requiredRunners {
 				provisionedRunners++
@@ -134,66 +167,7 @@ func (p *RunnerMessageProcessor) processRunnerMessage(message *types.RunnerScale
 
 				job := newJobIdentity(jobAssigned.JobId, jobAssigned.RunnerRequestId)
 
-				go func() {
-					var executionErr error
-
-					defer p.removeUpstreamCanceledJob(job)
-
-					executor, commands, provisioningErr := p.provisionRunnerWithRetry(p.ctx, job)
-					if provisioningErr != nil {
-						if errors.Is(provisioningErr, context.Canceled) {
-							p.logger.Infof("provisioning canceled for %s", p.runnerScaleSetName)
-						} else {
-							p.logger.Errorf("unable to provision Orka runner for %s: %v", p.runnerScaleSetName, provisioningErr)
-						}
-						return
-					}
-
-					if executor == nil {
-						p.logger.Errorf("provisioning returned nil executor for %s", p.runnerScaleSetName)
-						return
-					}
-
-					runnerContext, cancel := context.WithCancel(p.ctx)
-					p.storeRunnerContextCancel(executor.VMName, cancel)
-
-					context.AfterFunc(runnerContext, func() {
-						p.logger.Infof("cleaning up resources for %s after runner context is canceled", executor.VMName)
-						p.runnerProvisioner.CleanupResources(context.WithoutCancel(p.ctx), executor.VMName)
-						p.vmTracker.Untrack(executor.VMName)
-					})
-
-					defer func() {
-						if isNetworkingFailure(executionErr) {
-							p.logger.Warnf("SSH connection dropped for %s (%v). Skipping cleanup, relying on JobCompleted webhook.", job, executionErr)
-							return
-						}
-
-						var cancelReason string
-						var exitErr *ssh.ExitError
-
-						if errors.Is(executionErr, context.Canceled) {
-							cancelReason = "runner context was canceled"
-							p.logger.Infof("runner context canceled for RunnerName %s with %s. Cleaning up resources.", executor.VMName, job)
-						} else if executionErr != nil {
-							if errors.As(executionErr, &exitErr) {
-								cancelReason = fmt.Sprintf("execution failed with exit code %d", exitErr.ExitStatus())
-								p.logger.Errorf("execution failed with exit code %d for RunnerName %s with %s. Cleaning up resources.", exitErr.ExitStatus(), executor.VMName, job)
-							} else {
-								cancelReason = fmt.Sprintf("execution failed: %v", executionErr)
-								p.logger.Errorf("execution failed for RunnerName %s with %s. Cleaning up resources: %v", executor.VMName, job, executionErr)
-							}
-						} else {
-							cancelReason = "execution completed successfully"
-							p.logger.Infof("execution completed successfully for RunnerName %s with %s. Cleaning up resources.", executor.VMName, job)
-						}
-
-						p.cancelRunnerContext(executor.VMName, cancelReason)
-					}()
-
-					p.vmTracker.Track(executor.VMName)
-					executionErr = p.executeJobCommands(runnerContext, job, executor, commands)
-				}()
+				go p.runRunner(job, &jobAssigned.JobMessageBase)
 			}
 		case "JobStarted":
 			var jobStarted types.JobStarted
@@ -201,6 +175,8 @@ func (p *RunnerMessageProcessor) processRunnerMessage(message *types.RunnerScale
 				return fmt.Errorf("could not decode job started message. %w", err)
 			}
 			p.logger.Infof("Job started message received for JobId: %s, RunnerRequestId: %d, RunnerId: %d, RunnerName: %s", jobStarted.JobId, jobStarted.RunnerRequestId, jobStarted.RunnerId, jobStarted.RunnerName)
+			p.removeIdleRunner(jobStarted.RunnerName)
+			observeBetween(metrics.JobStartDelay.WithLabelValues(p.runnerScaleSetName), jobStarted.ScaleSetAssignTime, jobStarted.RunnerAssignTime)
 		case "JobCompleted":
 			var jobCompleted types.JobCompleted
 			if err := json.Unmarshal(message, &jobCompleted); err != nil {
@@ -208,10 +184,21 @@ func (p *RunnerMessageProcessor) processRunnerMessage(message *types.RunnerScale
 			}
 
 			p.logger.Infof("Job completed message received for JobId: %s, RunnerRequestId: %d, RunnerId: %d, RunnerName: %s, with Result: %s", jobCompleted.JobId, jobCompleted.RunnerRequestId, jobCompleted.RunnerId, jobCompleted.RunnerName, jobCompleted.Result)
+			observeBetween(metrics.JobDuration.WithLabelValues(p.runnerScaleSetName, jobCompleted.Result), jobCompleted.RunnerAssignTime, jobCompleted.FinishTime)
+
+			jobAttributes := []attribute.KeyValue{
+				tracing.JobIdKey.String(jobCompleted.JobId),
+				tracing.JobResultKey.String(jobCompleted.Result),
+				tracing.RunnerNameKey.String(jobCompleted.RunnerName),
+				tracing.ScaleSetKey.String(p.runnerScaleSetName),
+			}
+			_, completedSpan := tracing.StartJobSpan(p.ctx, jobCompleted.RunnerRequestId, "JobCompleted", jobAttributes...)
+			completedSpan.End()
+			tracing.RecordJob(p.ctx, jobCompleted.RunnerRequestId, jobCompleted.QueueTime, jobCompleted.FinishTime, jobAttributes...)
 
 			runnerName := jobCompleted.RunnerName
 			if runnerName != "" {
-				p.cancelRunnerContext(runnerName, "Job completed webhook received")
+				p.completeRunner(runnerName)
 			} else {
 				p.logger.Warnf("Job completed message received for JobId: %s, RunnerRequestId: %d, RunnerId: %d, but RunnerName is empty. Skipping cleanup.", jobCompleted.JobId, jobCompleted.RunnerRequestId, jobCompleted.RunnerId)
 			}
@@ -226,7 +213,27 @@ func (p *RunnerMessageProcessor) processRunnerMessage(message *types.RunnerScale
 		}
 	}
 
+	if p.draining.Load() && len(availableJobs) > 0 {
+		p.logger.Infof("draining, not acquiring %d available jobs", len(availableJobs))
+		availableJobs = nil
+	}
+
+	// Runners started for this batch may not hold or wait for a slot yet, so they are subtracted as well.
+	if available := max(p.runnerProvisioner.AvailableRunnerSlots()-provisionedRunners, 0); len(availableJobs) > available {
+		p.logger.Infof("runner limit allows %d more runners, acquiring %d of %d available jobs", available, available, len(availableJobs))
+		availableJobs = availableJobs[:available]
+	}
+
+	acquireSpans := make([]trace.Span, 0, len(availableJobs))
+	for _, runnerRequestId := range availableJobs {
+		_, span := tracing.StartJobSpan(p.ctx, runnerRequestId, "AcquireJobs", tracing.ScaleSetKey.String(p.runnerScaleSetName))
+		acquireSpans = append(acquireSpans, span)
+	}
+
 	err := p.runnerManager.AcquireJobs(p.ctx, availableJobs)
+	for _, span := range acquireSpans {
+		tracing.End(span, err)
+	}
 	if err != nil {
 		return fmt.Errorf("could not acquire jobs. %w", err)
 	}
@@ -234,9 +241,184 @@ func (p *RunnerMessageProcessor) processRunnerMessage(message *types.RunnerScale
 	return nil
 }
 
-func (p *RunnerMessageProcessor) provisionRunnerWithRetry(ctx context.Context, job jobIdentity) (*orka.VMCommandExecutor, []string, error) {
+// runRunner provisions a runner for the job and runs it until the job completes. An empty job provisions an idle
+// runner that waits for any job of the scale set. The details of the job are nil for idle runners.
+func (p *RunnerMessageProcessor) runRunner(job jobIdentity, details *types.JobMessageBase) {
+	p.activeRunners.Add(1)
+	finished := sync.OnceFunc(func() { p.activeRunners.Add(-1) })
+
+	if p.runnerProvisioner.AvailableRunnerSlots() == 0 {
+		p.logger.Infof("runner limit reached for %s, %s waits for a free slot", p.runnerScaleSetName, job)
+	}
+
+	if err := p.runnerProvisioner.AcquireRunnerSlot(p.ctx); err != nil {
+		p.logger.Infof("waiting for a runner slot canceled for %s", job)
+		p.removeUpstreamCanceledJob(job)
+		p.finishIdleRunnerProvisioning(job, "")
+		finished()
+		return
+	}
+	releaseSlot := sync.OnceFunc(p.runnerProvisioner.ReleaseRunnerSlot)
+
+	var executionErr error
+
+	defer p.removeUpstreamCanceledJob(job)
+
+	provisionCtx, provisionSpan := tracing.StartJobSpan(p.ctx, job.runnerRequestId, "ProvisionRunner", tracing.JobIdKey.String(job.jobId), tracing.ScaleSetKey.String(p.runnerScaleSetName))
+	executor, commands, provisioningErr := p.provisionRunnerWithRetry(provisionCtx, job, details)
+	tracing.End(provisionSpan, provisioningErr)
+	if provisioningErr != nil || executor == nil {
+		releaseSlot()
+		p.finishIdleRunnerProvisioning(job, "")
+		finished()
+	}
+
+	if provisioningErr != nil {
+		if errors.Is(provisioningErr, context.Canceled) {
+			p.logger.Infof("provisioning canceled for %s", p.runnerScaleSetName)
+		} else {
+			p.logger.Errorf("unable to provision Orka runner for %s: %v", p.runnerScaleSetName, provisioningErr)
+		}
+		return
+	}
+
+	if executor == nil {
+		p.logger.Errorf("provisioning returned nil executor for %s", p.runnerScaleSetName)
+		return
+	}
+
+	p.finishIdleRunnerProvisioning(job, executor.VMName)
+
+	runnerContext := p.startRunnerContext(executor.VMName, func() {
+		releaseSlot()
+		finished()
+	})
+
+	if job.isIdleRunner() && p.draining.Load() {
+		p.cancelRunnerContext(executor.VMName, "drain")
+	}
+
+	defer func() {
+		if errors.Is(executionErr, orka.ErrSSHConnect) || errors.Is(executionErr, orka.ErrHostKeyMismatch) {
+			metrics.ProvisioningFailures.WithLabelValues(p.runnerScaleSetName, metrics.FailureReasonSSHConnect).Inc()
+		}
+
+		if isNetworkingFailure(executionErr) {
+			p.logger.Warnf("SSH connection dropped for %s (%v). Skipping cleanup, relying on JobCompleted webhook or the VM tracker.", job, executionErr)
+			return
+		}
+
+		var cancelReason string
+		var exitErr *ssh.ExitError
+
+		if errors.Is(executionErr, context.Canceled) {
+			cancelReason = "runner context was canceled"
+			p.logger.Infof("runner context canceled for RunnerName %s with %s. Cleaning up resources.", executor.VMName, job)
+		} else if executionErr != nil {
+			if errors.As(executionErr, &exitErr) {
+				cancelReason = fmt.Sprintf("execution failed with exit code %d", exitErr.ExitStatus())
+				p.logger.Errorf("execution failed with exit code %d for RunnerName %s with %s. Cleaning up resources.", exitErr.ExitStatus(), executor.VMName, job)
+			} else {
+				cancelReason = fmt.Sprintf("execution failed: %v", executionErr)
+				p.logger.Errorf("execution failed for RunnerName %s with %s. Cleaning up resources: %v", executor.VMName, job, executionErr)
+			}
+		} else {
+			cancelReason = "execution completed successfully"
+			p.logger.Infof("execution completed successfully for RunnerName %s with %s. Cleaning up resources.", executor.VMName, job)
+		}
+
+		p.cancelRunnerContext(executor.VMName, cancelReason)
+	}()
+
+	p.vmTracker.Track(executor.VMName)
+	defer p.endRunnerSession(executor.VMName, p.startRunnerSession(executor.VMName))
+	executionErr = p.executeJobCommands(runnerContext, job, executor, commands)
+}
+
+// completeRunner cleans up the runner of a completed job. The runner exits when its job completes, but the SSH session
+// then still runs the post-job hooks, so a runner with a running session gets until the post-job hook timeout to exit
+// before it is canceled.
+func (p *RunnerMessageProcessor) completeRunner(runnerName string) {
+	timeout := p.runnerProvisioner.PostJobHookTimeout()
+	p.runnerSessionsMutex.Lock()
+	sessionDone := p.runnerSessions[runnerName]
+	p.runnerSessionsMutex.Unlock()
+
+	if timeout == 0 || sessionDone == nil {
+		p.cancelRunnerContext(runnerName, "Job completed webhook received")
+		return
+	}
+
+	p.logger.Infof("job of %s completed, waiting up to %v for the post-job hooks", runnerName, timeout)
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-sessionDone:
+			p.cancelRunnerContext(runnerName, "Job completed webhook received")
+		case <-timer.C:
+			p.cancelRunnerContext(runnerName, "post-job hooks timed out after the job completed")
+		}
+	}()
+}
+
+// startRunnerSession records that the SSH session of the runner is running. The returned channel is closed when it ends.
+func (p *RunnerMessageProcessor) startRunnerSession(runnerName string) chan struct{} {
+	p.runnerSessionsMutex.Lock()
+	defer p.runnerSessionsMutex.Unlock()
+
+	sessionDone := make(chan struct{})
+	p.runnerSessions[runnerName] = sessionDone
+
+	return sessionDone
+}
+
+func (p *RunnerMessageProcessor) endRunnerSession(runnerName string, sessionDone chan struct{}) {
+	p.runnerSessionsMutex.Lock()
+	defer p.runnerSessionsMutex.Unlock()
+
+	delete(p.runnerSessions, runnerName)
+	close(sessionDone)
+}
+
+// AdoptRunner takes over a runner that was started by a previous process and is still running a job. Its resources
+// are cleaned up once the job completed message arrives, the runner is canceled, or the VM tracker deletes the VM
+// after the runner de-registered.
+func (p *RunnerMessageProcessor) AdoptRunner(runnerName string) {
+	p.logger.Infof("adopting runner %s", runnerName)
+
+	p.activeRunners.Add(1)
+	runnerContext := p.startRunnerContext(runnerName, func() { p.activeRunners.Add(-1) })
+	p.vmTracker.Track(runnerName)
+
+	go func() {
+		if err := p.runnerProvisioner.AcquireRunnerSlot(p.ctx); err != nil {
+			return
+		}
+		context.AfterFunc(runnerContext, p.runnerProvisioner.ReleaseRunnerSlot)
+	}()
+}
+
+// startRunnerContext returns the context of a runner. Canceling it cleans up the runner's resources and then calls done.
+func (p *RunnerMessageProcessor) startRunnerContext(runnerName string, done func()) context.Context {
+	runnerContext, cancel := context.WithCancel(p.ctx)
+	p.storeRunnerContextCancel(runnerName, cancel)
+
+	context.AfterFunc(runnerContext, func() {
+		p.logger.Infof("cleaning up resources for %s after runner context is canceled", runnerName)
+		p.runnerProvisioner.CleanupResources(context.WithoutCancel(p.ctx), runnerName)
+		p.vmTracker.Untrack(runnerName)
+		p.removeIdleRunner(runnerName)
+		done()
+	})
+
+	return runnerContext
+}
+
+func (p *RunnerMessageProcessor) provisionRunnerWithRetry(ctx context.Context, job jobIdentity, details *types.JobMessageBase) (*orka.VMCommandExecutor, []string, error) {
 	for attempt := 1; !p.isUpstreamCanceled(job); attempt++ {
-		executor, commands, err := p.runnerProvisioner.ProvisionRunner(ctx)
+		executor, commands, err := p.runnerProvisioner.ProvisionRunner(ctx, details)
 		if ctx.Err() != nil {
 			return nil, nil, ctx.Err()
 		}
@@ -263,10 +445,13 @@ func (p *RunnerMessageProcessor) provisionRunnerWithRetry(ctx context.Context, j
 	return nil, nil, fmt.Errorf("unable to provision Orka runner for %s and job %s", p.runnerScaleSetName, job)
 }
 
-func (p *RunnerMessageProcessor) executeJobCommands(ctx context.Context, job jobIdentity, executor *orka.VMCommandExecutor, commands []string) error {
+func (p *RunnerMessageProcessor) executeJobCommands(ctx context.Context, job jobIdentity, executor *orka.VMCommandExecutor, commands []string) (err error) {
 	p.logger.Infof("starting execution for %s on VM %s", job, executor.VMName)
 
-	err := executor.ExecuteCommands(ctx, commands...)
+	ctx, span := tracing.StartJobSpan(ctx, job.runnerRequestId, "ExecuteCommands", tracing.JobIdKey.String(job.jobId), tracing.RunnerNameKey.String(executor.VMName))
+	defer func() { tracing.End(span, err) }()
+
+	err = executor.ExecuteCommands(ctx, commands...)
 
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -281,6 +466,46 @@ func (p *RunnerMessageProcessor) executeJobCommands(ctx context.Context, job job
 	return nil
 }
 
+// ensureMinRunners starts idle runners until minRunners are registered or being provisioned.
+func (p *RunnerMessageProcessor) ensureMinRunners() {
+	if p.minRunners == 0 || p.draining.Load() {
+		return
+	}
+
+	p.idleRunnersMutex.Lock()
+	missing := p.minRunners - len(p.idleRunners) - p.pendingIdleRunners
+	if missing > 0 {
+		p.pendingIdleRunners += missing
+	}
+	p.idleRunnersMutex.Unlock()
+
+	for i := 0; i < missing; i++ {
+		p.logger.Infof("starting idle runner to keep %d idle runners for %s", p.minRunners, p.runnerScaleSetName)
+		go p.runRunner(jobIdentity{}, nil)
+	}
+}
+
+// finishIdleRunnerProvisioning records the VM of an idle runner once provisioning has finished. An empty name means it failed.
+func (p *RunnerMessageProcessor) finishIdleRunnerProvisioning(job jobIdentity, runnerName string) {
+	if !job.isIdleRunner() {
+		return
+	}
+
+	p.idleRunnersMutex.Lock()
+	defer p.idleRunnersMutex.Unlock()
+
+	p.pendingIdleRunners--
+	if runnerName != "" {
+		p.idleRunners[runnerName] = true
+	}
+}
+
+func (p *RunnerMessageProcessor) removeIdleRunner(runnerName string) {
+	p.idleRunnersMutex.Lock()
+	defer p.idleRunnersMutex.Unlock()
+	delete(p.idleRunners, runnerName)
+}
+
 func (p *RunnerMessageProcessor) isUpstreamCanceled(job jobIdentity) bool {
 	p.upstreamCanceledJobsMutex.RLock()
 	defer p.upstreamCanceledJobsMutex.RUnlock()
@@ -305,7 +530,7 @@ func (p *RunnerMessageProcessor) storeRunnerContextCancel(runnerName string, can
 	p.runnerContextCancels[runnerName] = cancel
 }
 
-func (p *RunnerMessageProcessor) cancelRunnerContext(runnerName string, reason string) {
+func (p *RunnerMessageProcessor) cancelRunnerContext(runnerName string, reason string) bool {
 	p.runnerContextCancelsMutex.Lock()
 	defer p.runnerContextCancelsMutex.Unlock()
 
@@ -313,9 +538,21 @@ func (p *RunnerMessageProcessor) cancelRunnerContext(runnerName string, reason s
 		p.logger.Infof("canceling runner context for RunnerName: %s. Triggered by: %s", runnerName, reason)
 		cancel()
 		delete(p.runnerContextCancels, runnerName)
-	} else {
-		p.logger.Debugf("runner context for RunnerName: %s already canceled or not found. Triggered by: %s", runnerName, reason)
+		return true
 	}
+
+	p.logger.Debugf("runner context for RunnerName: %s already canceled or not found. Triggered by: %s", runnerName, reason)
+	return false
+}
+
+// observeBetween records the time between two message timestamps. GitHub leaves timestamps empty for steps that did not
+// happen, for example, the runner assignment of a job that was canceled while queued.
+func observeBetween(observer prometheus.Observer, start, end time.Time) {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return
+	}
+
+	observer.Observe(end.Sub(start).Seconds())
 }
 
 func isNetworkingFailure(err error) bool {
@@ -324,5 +561,5 @@ func isNetworkingFailure(err error) bool {
 	}
 
 	var exitErr *ssh.ExitError
-	return !errors.As(err, &exitErr) && !errors.Is(err, context.Canceled)
+	return !errors.As(err, &exitErr) && !errors.Is(err, context.Canceled) && !errors.Is(err, orka.ErrHostKeyMismatch)
 }
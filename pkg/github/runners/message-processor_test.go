@@ -0,0 +1,179 @@
+package runners
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
+	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
+	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+type MockRunnerProvisioner struct {
+	mu                 sync.Mutex
+	cleanedUp          []string
+	slots              atomic.Int32
+	postJobHookTimeout time.Duration
+}
+
+func (m *MockRunnerProvisioner) ProvisionRunner(ctx context.Context, job *types.JobMessageBase) (*orka.VMCommandExecutor, []string, error) {
+	return nil, nil, nil
+}
+
+func (m *MockRunnerProvisioner) CleanupResources(ctx context.Context, runnerName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cleanedUp = append(m.cleanedUp, runnerName)
+}
+
+func (m *MockRunnerProvisioner) CleanedUp() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.cleanedUp...)
+}
+
+func (m *MockRunnerProvisioner) AcquireRunnerSlot(ctx context.Context) error {
+	m.slots.Add(1)
+	return nil
+}
+
+func (m *MockRunnerProvisioner) ReleaseRunnerSlot() {
+	m.slots.Add(-1)
+}
+
+func (m *MockRunnerProvisioner) AvailableRunnerSlots() int {
+	return 1
+}
+
+func (m *MockRunnerProvisioner) PostJobHookTimeout() time.Duration {
+	return m.postJobHookTimeout
+}
+
+type MockRunnerManager struct{}
+
+func (m *MockRunnerManager) ProcessMessages(ctx context.Context, handler func(msg *types.RunnerScaleSetMessage) error) error {
+	return nil
+}
+
+func (m *MockRunnerManager) AcquireJobs(ctx context.Context, requestIds []int64) error {
+	return nil
+}
+
+func (m *MockRunnerManager) LastPoll() time.Time {
+	return time.Now()
+}
+
+func (m *MockRunnerManager) CheckSession() error {
+	return nil
+}
+
+func jobCompletedMessage(runnerName string) *types.RunnerScaleSetMessage {
+	return &types.RunnerScaleSetMessage{
+		MessageId:   1,
+		MessageType: runnerScaleSetJobMessagesType,
+		Statistics:  &types.RunnerScaleSetStatistic{},
+		Body:        `[{"messageType":"JobCompleted","result":"succeeded","runnerName":"` + runnerName + `","jobId":"job-1","runnerRequestId":7}]`,
+	}
+}
+
+var _ = Describe("RunnerMessageProcessor", func() {
+	var (
+		processor   *RunnerMessageProcessor
+		provisioner *MockRunnerProvisioner
+		tracker     *VMTracker
+		mockActions *MockActionsClient
+	)
+
+	BeforeEach(func() {
+		logging.SetupLogger("info")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+
+		provisioner = &MockRunnerProvisioner{}
+		mockActions = &MockActionsClient{}
+		tracker = NewVMTracker(&MockOrkaClient{}, mockActions, "orka-default", zap.NewNop().Sugar())
+		processor = NewRunnerMessageProcessor(ctx, &MockRunnerManager{}, provisioner, tracker, &types.RunnerScaleSet{Id: 1, Name: "runner"}, 0)
+	})
+
+	It("should release an adopted runner once the VM tracker deletes its VM", func() {
+		processor.AdoptRunner("runner-abc12")
+		Expect(processor.ActiveRunners()).To(Equal(1))
+		Eventually(provisioner.slots.Load).Should(Equal(int32(1)))
+
+		tracker.checkaForOrphanedVMs(context.Background())
+		tracker.checkaForOrphanedVMs(context.Background())
+
+		Eventually(processor.ActiveRunners).WithTimeout(time.Second).Should(BeZero())
+		Eventually(provisioner.slots.Load).Should(BeZero())
+		Expect(provisioner.CleanedUp()).To(ConsistOf("runner-abc12"))
+		Expect(processor.CancelRunner("runner-abc12")).To(BeFalse())
+	})
+
+	It("should release an adopted runner when it is canceled", func() {
+		processor.AdoptRunner("runner-abc12")
+		Eventually(provisioner.slots.Load).Should(Equal(int32(1)))
+
+		Expect(processor.CancelRunner("runner-abc12")).To(BeTrue())
+
+		Eventually(processor.ActiveRunners).WithTimeout(time.Second).Should(BeZero())
+		Eventually(provisioner.slots.Load).Should(BeZero())
+		Expect(tracker.trackedVMs).To(BeEmpty())
+	})
+
+	It("should keep an adopted runner while it is registered", func() {
+		mockActions.GetRunnerFunc = func(ctx context.Context, runnerName string) (*types.RunnerReference, error) {
+			return &types.RunnerReference{Name: runnerName}, nil
+		}
+
+		processor.AdoptRunner("runner-abc12")
+
+		tracker.checkaForOrphanedVMs(context.Background())
+		tracker.checkaForOrphanedVMs(context.Background())
+
+		Consistently(processor.ActiveRunners).WithTimeout(100 * time.Millisecond).Should(Equal(1))
+		Expect(provisioner.CleanedUp()).To(BeEmpty())
+	})
+
+	Describe("when the job of a runner completes", func() {
+		startRunner := func(runnerName string) chan struct{} {
+			processor.startRunnerContext(runnerName, func() {})
+			return processor.startRunnerSession(runnerName)
+		}
+
+		It("should let the post-job hooks finish before cleaning up the runner", func() {
+			provisioner.postJobHookTimeout = time.Minute
+			sessionDone := startRunner("runner-abc12")
+
+			Expect(processor.processRunnerMessage(jobCompletedMessage("runner-abc12"))).To(Succeed())
+
+			Consistently(provisioner.CleanedUp).WithTimeout(100 * time.Millisecond).Should(BeEmpty())
+
+			processor.endRunnerSession("runner-abc12", sessionDone)
+
+			Eventually(provisioner.CleanedUp).WithTimeout(time.Second).Should(ConsistOf("runner-abc12"))
+		})
+
+		It("should cancel the runner when the post-job hooks time out", func() {
+			provisioner.postJobHookTimeout = 50 * time.Millisecond
+			startRunner("runner-abc12")
+
+			Expect(processor.processRunnerMessage(jobCompletedMessage("runner-abc12"))).To(Succeed())
+
+			Eventually(provisioner.CleanedUp).WithTimeout(time.Second).Should(ConsistOf("runner-abc12"))
+		})
+
+		It("should clean up right away without post-job hooks", func() {
+			startRunner("runner-abc12")
+
+			Expect(processor.processRunnerMessage(jobCompletedMessage("runner-abc12"))).To(Succeed())
+
+			Eventually(provisioner.CleanedUp).WithTimeout(time.Second).Should(ConsistOf("runner-abc12"))
+		})
+	})
+})
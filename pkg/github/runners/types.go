@@ -7,6 +7,8 @@ package runners
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/actions"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/messagequeue"
@@ -18,6 +20,8 @@ import (
 type RunnerManagerInterface interface {
 	ProcessMessages(ctx context.Context, handler func(msg *types.RunnerScaleSetMessage) error) error
 	AcquireJobs(ctx context.Context, requestIds []int64) error
+	LastPoll() time.Time
+	CheckSession() error
 }
 
 type RunnerManager struct {
@@ -29,11 +33,23 @@ type RunnerManager struct {
 
 	runnerScaleSetId int
 	actionsClient    actions.ActionsService
+
+	// pollMutex guards the result of the last message queue poll, which the health checks read.
+	pollMutex   sync.Mutex
+	lastPollAt  time.Time
+	lastPollErr error
+	closed      bool
 }
 
 type RunnerProvisionerInterface interface {
-	ProvisionRunner(ctx context.Context) (*orka.VMCommandExecutor, []string, error)
+	ProvisionRunner(ctx context.Context, job *types.JobMessageBase) (*orka.VMCommandExecutor, []string, error)
 	CleanupResources(ctx context.Context, runnerName string)
+
+	AcquireRunnerSlot(ctx context.Context) error
+	ReleaseRunnerSlot()
+	AvailableRunnerSlots() int
+
+	PostJobHookTimeout() time.Duration
 }
 
 type RunnerMessageProcessor struct {
@@ -47,4 +63,16 @@ type RunnerMessageProcessor struct {
 	upstreamCanceledJobsMutex sync.RWMutex
 	runnerContextCancels      map[string]context.CancelFunc
 	runnerContextCancelsMutex sync.Mutex
+	runnerSessions            map[string]chan struct{}
+	runnerSessionsMutex       sync.Mutex
+	minRunners                int
+	idleRunners               map[string]bool
+	pendingIdleRunners        int
+	idleRunnersMutex          sync.Mutex
+	activeRunners             atomic.Int64
+	draining                  atomic.Bool
+	paused                    bool
+	resumed                   chan struct{}
+	resumedAt                 time.Time
+	pauseMutex                sync.Mutex
 }
@@ -0,0 +1,135 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/actions"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
+	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+	"go.uber.org/zap"
+)
+
+// VMSweeper finds VMs of a runner scale set that were left behind, for example, by an earlier instance of the
+// process, and deletes the ones that have had no GitHub runner for longer than the grace period.
+type VMSweeper struct {
+	orkaClient    orka.OrkaService
+	actionsClient actions.ActionsService
+	namespace     string
+	controllerId  string
+	scaleSetName  string
+	isManaged     func(vmName string) bool
+	gracePeriod   time.Duration
+	dryRun        bool
+	logger        *zap.SugaredLogger
+
+	mu            sync.Mutex
+	orphanedSince map[string]time.Time
+}
+
+// NewVMSweeper creates a sweeper for the VMs that carry the ownership tag of the controller and scale set. VMs for which
+// isManaged returns true are in use by this process and are never swept.
+func NewVMSweeper(orkaClient orka.OrkaService, actionsClient actions.ActionsService, namespace, controllerId, scaleSetName string, isManaged func(vmName string) bool, gracePeriod time.Duration, dryRun bool, logger *zap.SugaredLogger) *VMSweeper {
+	return &VMSweeper{
+		orkaClient:    orkaClient,
+		actionsClient: actionsClient,
+		namespace:     namespace,
+		controllerId:  controllerId,
+		scaleSetName:  scaleSetName,
+		isManaged:     isManaged,
+		gracePeriod:   gracePeriod,
+		dryRun:        dryRun,
+		logger:        logger.Named("vm-sweeper"),
+		orphanedSince: map[string]time.Time{},
+	}
+}
+
+func (sweeper *VMSweeper) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sweeper.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (sweeper *VMSweeper) sweep(ctx context.Context) {
+	vms, err := sweeper.orkaClient.ListVMs(ctx, sweeper.namespace)
+	if err != nil {
+		sweeper.logger.Warnf("unable to list VMs in namespace %s: %v", sweeper.namespace, err)
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, vm := range vms {
+		if !orka.IsOwnedBy(vm, sweeper.controllerId, sweeper.scaleSetName) || sweeper.isManaged(vm.Name) {
+			continue
+		}
+		seen[vm.Name] = true
+
+		runner, err := sweeper.actionsClient.GetRunner(ctx, vm.Name)
+		if err != nil {
+			sweeper.logger.Warnf("failed to check GitHub for %s: %v", vm.Name, err)
+			continue
+		}
+
+		if runner != nil {
+			sweeper.forget(vm.Name)
+			continue
+		}
+
+		since := sweeper.markOrphaned(vm.Name)
+		if time.Since(since) < sweeper.gracePeriod {
+			sweeper.logger.Infof("VM %s has no GitHub runner, deleting it after the grace period of %v", vm.Name, sweeper.gracePeriod)
+			continue
+		}
+
+		if sweeper.dryRun {
+			sweeper.logger.Infof("dry run: would delete VM %s without a GitHub runner since %v", vm.Name, since.Format(time.RFC3339))
+			continue
+		}
+
+		sweeper.logger.Infof("deleting VM %s without a GitHub runner since %v", vm.Name, since.Format(time.RFC3339))
+		if err := sweeper.orkaClient.DeleteVM(ctx, sweeper.namespace, vm.Name); err != nil && !errors.Is(err, orka.ErrVMNotFound) {
+			sweeper.logger.Errorf("failed to delete leftover VM %s: %v", vm.Name, err)
+			continue
+		}
+		metrics.OrphanedVMsDeleted.WithLabelValues(sweeper.namespace, metrics.OrphanSourceSweeper).Inc()
+		sweeper.forget(vm.Name)
+	}
+
+	sweeper.mu.Lock()
+	for name := range sweeper.orphanedSince {
+		if !seen[name] {
+			delete(sweeper.orphanedSince, name)
+		}
+	}
+	sweeper.mu.Unlock()
+}
+
+func (sweeper *VMSweeper) markOrphaned(vmName string) time.Time {
+	sweeper.mu.Lock()
+	defer sweeper.mu.Unlock()
+
+	since, ok := sweeper.orphanedSince[vmName]
+	if !ok {
+		since = time.Now()
+		sweeper.orphanedSince[vmName] = since
+	}
+
+	return since
+}
+
+func (sweeper *VMSweeper) forget(vmName string) {
+	sweeper.mu.Lock()
+	defer sweeper.mu.Unlock()
+	delete(sweeper.orphanedSince, vmName)
+}
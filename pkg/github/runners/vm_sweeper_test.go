@@ -0,0 +1,102 @@
+package runners
+
+import (
+	"context"
+	"time"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/env"
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
+	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("VMSweeper", func() {
+	var (
+		sweeper     *VMSweeper
+		mockOrka    *MockOrkaClient
+		mockActions *MockActionsClient
+		ctx         context.Context
+		deleted     []string
+	)
+
+	newSweeper := func(gracePeriod time.Duration, dryRun bool) *VMSweeper {
+		isManaged := func(vmName string) bool { return vmName == "runner-manag" }
+		return NewVMSweeper(mockOrka, mockActions, "orka-default", "controller-1", "runner", isManaged, gracePeriod, dryRun, zap.NewNop().Sugar())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		deleted = nil
+		mockOrka = &MockOrkaClient{
+			ListVMsFunc: func(ctx context.Context, namespace string) ([]*orka.OrkaVMResponseModel, error) {
+				owned := map[string]string{orka.ControllerMetadataKey: "controller-1", orka.ScaleSetMetadataKey: "runner"}
+				return []*orka.OrkaVMResponseModel{
+					{Name: "runner-abc12", Metadata: owned},
+					{Name: "runnerxyz89", Metadata: owned},
+					{Name: "runner-busy1", Metadata: owned},
+					{Name: "runner-manag", Metadata: owned},
+					{Name: "runner-def34"},
+					{Name: "runner-ghi56", Metadata: map[string]string{orka.ControllerMetadataKey: "controller-2", orka.ScaleSetMetadataKey: "runner"}},
+					{Name: "runner-2-abc12", Metadata: map[string]string{orka.ControllerMetadataKey: "controller-1", orka.ScaleSetMetadataKey: "runner-2"}},
+				}, nil
+			},
+			DeleteVMFunc: func(ctx context.Context, namespace, name string) error {
+				deleted = append(deleted, name)
+				return nil
+			},
+		}
+		mockActions = &MockActionsClient{
+			GetRunnerFunc: func(ctx context.Context, runnerName string) (*types.RunnerReference, error) {
+				if runnerName == "runner-busy1" {
+					return &types.RunnerReference{Name: runnerName}, nil
+				}
+				return nil, nil
+			},
+		}
+	})
+
+	It("should delete owned VMs without a runner once the grace period passed", func() {
+		swept := metrics.OrphanedVMsDeleted.WithLabelValues("orka-default", metrics.OrphanSourceSweeper)
+		before := testutil.ToFloat64(swept)
+
+		sweeper = newSweeper(0, false)
+		sweeper.sweep(ctx)
+
+		Expect(deleted).To(ConsistOf("runner-abc12", "runnerxyz89"))
+		Expect(sweeper.orphanedSince).To(BeEmpty())
+		Expect(testutil.ToFloat64(swept) - before).To(Equal(2.0))
+	})
+
+	It("should wait for the grace period", func() {
+		sweeper = newSweeper(time.Hour, false)
+		sweeper.sweep(ctx)
+
+		Expect(deleted).To(BeEmpty())
+		Expect(sweeper.orphanedSince).To(HaveLen(2))
+	})
+
+	It("should delete the VMs a previous process of the controller left behind", func() {
+		controllerId := env.DefaultControllerId("https://github.com/org")
+		mockOrka.ListVMsFunc = func(ctx context.Context, namespace string) ([]*orka.OrkaVMResponseModel, error) {
+			return []*orka.OrkaVMResponseModel{
+				{Name: "runner-abc12", Metadata: map[string]string{orka.ControllerMetadataKey: controllerId, orka.ScaleSetMetadataKey: "runner"}},
+			}, nil
+		}
+
+		sweeper = NewVMSweeper(mockOrka, mockActions, "orka-default", env.DefaultControllerId("https://github.com/org"), "runner", func(string) bool { return false }, 0, false, zap.NewNop().Sugar())
+		sweeper.sweep(ctx)
+
+		Expect(deleted).To(ConsistOf("runner-abc12"))
+	})
+
+	It("should only report VMs in dry-run mode", func() {
+		sweeper = newSweeper(0, true)
+		sweeper.sweep(ctx)
+
+		Expect(deleted).To(BeEmpty())
+	})
+})
@@ -2,11 +2,12 @@ package runners
 
 import (
 	"context"
-	"strings"
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/actions"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
 	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
 	"go.uber.org/zap"
 )
@@ -14,21 +15,32 @@ import (
 type VMTracker struct {
 	orkaClient    orka.OrkaService
 	actionsClient actions.ActionsService
+	namespace     string
 	logger        *zap.SugaredLogger
 
 	mu         sync.Mutex
 	trackedVMs map[string]int
+	onDeleted  func(vmName string)
 }
 
-func NewVMTracker(orkaClient orka.OrkaService, actionsClient actions.ActionsService, logger *zap.SugaredLogger) *VMTracker {
+func NewVMTracker(orkaClient orka.OrkaService, actionsClient actions.ActionsService, namespace string, logger *zap.SugaredLogger) *VMTracker {
 	return &VMTracker{
 		orkaClient:    orkaClient,
 		actionsClient: actionsClient,
+		namespace:     namespace,
 		logger:        logger.Named("vm-tracker"),
 		trackedVMs:    make(map[string]int),
 	}
 }
 
+// OnDeleted registers a function that is called after the tracker deleted an orphaned VM, so that the owner of the
+// VM can release the resources it holds for it.
+func (tracker *VMTracker) OnDeleted(handler func(vmName string)) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	tracker.onDeleted = handler
+}
+
 func (tracker *VMTracker) Track(vmName string) {
 	tracker.mu.Lock()
 	defer tracker.mu.Unlock()
@@ -99,12 +111,21 @@ func (tracker *VMTracker) checkaForOrphanedVMs(ctx context.Context) {
 }
 
 func (tracker *VMTracker) cleanupOrphanedVM(ctx context.Context, vmName string) {
-	err := tracker.orkaClient.DeleteVM(ctx, vmName)
-	if err != nil && !strings.Contains(err.Error(), "not found") {
+	err := tracker.orkaClient.DeleteVM(ctx, tracker.namespace, vmName)
+	if err != nil && !errors.Is(err, orka.ErrVMNotFound) {
 		tracker.logger.Errorf("Failed to delete orphaned VM %s: %v", vmName, err)
 		return
 	}
 
 	tracker.Untrack(vmName)
+	metrics.OrphanedVMsDeleted.WithLabelValues(tracker.namespace, metrics.OrphanSourceTracker).Inc()
 	tracker.logger.Infof("Successfully deleted orphaned VM %s", vmName)
+
+	tracker.mu.Lock()
+	onDeleted := tracker.onDeleted
+	tracker.mu.Unlock()
+
+	if onDeleted != nil {
+		onDeleted(vmName)
+	}
 }
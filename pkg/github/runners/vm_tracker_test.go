@@ -19,20 +19,44 @@ func TestVMTracker(t *testing.T) {
 }
 
 type MockOrkaClient struct {
-	DeleteVMFunc func(ctx context.Context, name string) error
-	DeployVMFunc func(ctx context.Context, namePrefix, vmConfig string) (*orka.OrkaVMDeployResponseModel, error)
+	DeleteVMFunc func(ctx context.Context, namespace, name string) error
+	DeployVMFunc func(ctx context.Context, options *orka.DeployVMOptions) (*orka.OrkaVMDeployResponseModel, error)
+	GetVMFunc    func(ctx context.Context, namespace, name string) (*orka.OrkaVMResponseModel, error)
+	ListVMsFunc  func(ctx context.Context, namespace string) ([]*orka.OrkaVMResponseModel, error)
 }
 
-func (m *MockOrkaClient) DeleteVM(ctx context.Context, name string) error {
+func (m *MockOrkaClient) ListNodes(ctx context.Context, namespace string) ([]*orka.OrkaNodeResponseModel, error) {
+	return nil, nil
+}
+
+func (m *MockOrkaClient) GetVMConfig(ctx context.Context, name string) (*orka.OrkaVMConfigResponseModel, error) {
+	return nil, nil
+}
+
+func (m *MockOrkaClient) GetVM(ctx context.Context, namespace, name string) (*orka.OrkaVMResponseModel, error) {
+	if m.GetVMFunc != nil {
+		return m.GetVMFunc(ctx, namespace, name)
+	}
+	return nil, nil
+}
+
+func (m *MockOrkaClient) ListVMs(ctx context.Context, namespace string) ([]*orka.OrkaVMResponseModel, error) {
+	if m.ListVMsFunc != nil {
+		return m.ListVMsFunc(ctx, namespace)
+	}
+	return nil, nil
+}
+
+func (m *MockOrkaClient) DeleteVM(ctx context.Context, namespace, name string) error {
 	if m.DeleteVMFunc != nil {
-		return m.DeleteVMFunc(ctx, name)
+		return m.DeleteVMFunc(ctx, namespace, name)
 	}
 	return nil
 }
 
-func (m *MockOrkaClient) DeployVM(ctx context.Context, namePrefix, vmConfig string) (*orka.OrkaVMDeployResponseModel, error) {
+func (m *MockOrkaClient) DeployVM(ctx context.Context, options *orka.DeployVMOptions) (*orka.OrkaVMDeployResponseModel, error) {
 	if m.DeployVMFunc != nil {
-		return m.DeployVMFunc(ctx, namePrefix, vmConfig)
+		return m.DeployVMFunc(ctx, options)
 	}
 	return nil, nil
 }
@@ -54,6 +78,9 @@ func (m *MockActionsClient) GetRunnerScaleSet(ctx context.Context, id int, name
 func (m *MockActionsClient) CreateRunnerScaleSet(ctx context.Context, rs *types.RunnerScaleSet) (*types.RunnerScaleSet, error) {
 	return nil, nil
 }
+func (m *MockActionsClient) UpdateRunnerScaleSet(ctx context.Context, id int, rs *types.RunnerScaleSet) (*types.RunnerScaleSet, error) {
+	return nil, nil
+}
 func (m *MockActionsClient) DeleteRunnerScaleSet(ctx context.Context, id int) error { return nil }
 func (m *MockActionsClient) CreateRunner(ctx context.Context, id int, name string) (*types.RunnerScaleSetJitRunnerConfig, error) {
 	return nil, nil
@@ -97,7 +124,7 @@ var _ = Describe("VMTracker", func() {
 		ctx = context.Background()
 		vmName = "orka-vm-test-1"
 
-		tracker = NewVMTracker(mockOrka, mockActions, logger)
+		tracker = NewVMTracker(mockOrka, mockActions, "orka-default", logger)
 	})
 
 	Describe("Tracking State", func() {
@@ -143,7 +170,7 @@ var _ = Describe("VMTracker", func() {
 					return nil, nil
 				}
 
-				mockOrka.DeleteVMFunc = func(c context.Context, n string) error {
+				mockOrka.DeleteVMFunc = func(c context.Context, ns, n string) error {
 					Fail("DeleteVM should not be called on first strike")
 					return nil
 				}
@@ -178,7 +205,8 @@ var _ = Describe("VMTracker", func() {
 				}
 
 				deleteCalled := false
-				mockOrka.DeleteVMFunc = func(c context.Context, n string) error {
+				mockOrka.DeleteVMFunc = func(c context.Context, ns, n string) error {
+					Expect(ns).To(Equal("orka-default"))
 					Expect(n).To(Equal(vmName))
 					deleteCalled = true
 					return nil
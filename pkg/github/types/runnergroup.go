@@ -0,0 +1,24 @@
+package types
+
+type RunnerGroup struct {
+	Id         int    `json:"id"`
+	Name       string `json:"name"`
+	Visibility string `json:"visibility"`
+	Default    bool   `json:"default"`
+}
+
+type RunnerGroupList struct {
+	TotalCount   int           `json:"total_count"`
+	RunnerGroups []RunnerGroup `json:"runner_groups"`
+}
+
+type CreateRunnerGroupRequest struct {
+	Name                  string `json:"name"`
+	Visibility            string `json:"visibility,omitempty"`
+	SelectedRepositoryIds []int  `json:"selected_repository_ids,omitempty"`
+}
+
+type Repository struct {
+	Id       int    `json:"id"`
+	FullName string `json:"full_name"`
+}
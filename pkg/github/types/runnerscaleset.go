@@ -83,4 +83,12 @@ type RunnerReference struct {
 	Id               int    `json:"id"`
 	Name             string `json:"name"`
 	RunnerScaleSetId int    `json:"runnerScaleSetId"`
+	// Busy is true while the runner is running a job. It is nil when the service does not return it.
+	Busy *bool `json:"busy,omitempty"`
+	// Status is `online` while the runner process is connected to GitHub, and `offline` otherwise. It is empty when the
+	// service does not return it.
+	Status string `json:"status,omitempty"`
 }
+
+// RunnerStatusOnline is the status of a runner whose process is connected to GitHub.
+const RunnerStatusOnline = "online"
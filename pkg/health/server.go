@@ -0,0 +1,132 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// checkTimeout bounds how long a single check may take, so that a hanging dependency fails the probe instead of
+// blocking it.
+const checkTimeout = 5 * time.Second
+
+// Check returns an error when the component it checks is unhealthy.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Server exposes Kubernetes style probes. /healthz runs the liveness checks and /readyz the readiness checks. A probe
+// responds with 200 when all of its checks pass and with 503 otherwise.
+type Server struct {
+	logger *zap.SugaredLogger
+
+	mu        sync.Mutex
+	liveness  []namedCheck
+	readiness []namedCheck
+}
+
+type Response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+const (
+	statusOK     = "ok"
+	statusFailed = "failed"
+)
+
+func NewServer(logger *zap.SugaredLogger) *Server {
+	return &Server{
+		logger: logger.Named("health"),
+	}
+}
+
+// AddLivenessCheck adds a check that fails /healthz. Liveness checks should only fail when restarting the process helps.
+func (s *Server) AddLivenessCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.liveness = append(s.liveness, namedCheck{name: name, check: check})
+}
+
+// AddReadinessCheck adds a check that fails /readyz.
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.readiness = append(s.readiness, namedCheck{name: name, check: check})
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		s.serveChecks(w, r, s.checks(&s.liveness))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		s.serveChecks(w, r, s.checks(&s.readiness))
+	})
+
+	return mux
+}
+
+func (s *Server) Start(ctx context.Context, addr string) {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: s.Handler(),
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	s.logger.Infof("health probes available at %s", addr)
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.logger.Errorf("health probe server failed: %v", err)
+	}
+}
+
+func (s *Server) checks(checks *[]namedCheck) []namedCheck {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]namedCheck{}, *checks...)
+}
+
+func (s *Server) serveChecks(w http.ResponseWriter, r *http.Request, checks []namedCheck) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	response := Response{
+		Status: statusOK,
+		Checks: make(map[string]string, len(checks)),
+	}
+
+	for _, c := range checks {
+		if err := c.check(ctx); err != nil {
+			s.logger.Warnf("%s check failed on %s: %v", c.name, r.URL.Path, err)
+			response.Status = statusFailed
+			response.Checks[c.name] = err.Error()
+			continue
+		}
+
+		response.Checks[c.name] = statusOK
+	}
+
+	statusCode := http.StatusOK
+	if response.Status != statusOK {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,71 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+func TestHealth(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Health Suite")
+}
+
+var _ = Describe("Server", func() {
+	var server *Server
+
+	probe := func(path string) (int, Response) {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var response Response
+		Expect(json.Unmarshal(rec.Body.Bytes(), &response)).To(Succeed())
+		return rec.Code, response
+	}
+
+	passing := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("session expired") }
+
+	BeforeEach(func() {
+		server = NewServer(zap.NewNop().Sugar())
+	})
+
+	It("should report ok when all checks pass", func() {
+		server.AddLivenessCheck("message-loop", passing)
+		server.AddLivenessCheck("github-token", passing)
+
+		code, response := probe("/healthz")
+
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(response.Status).To(Equal(statusOK))
+		Expect(response.Checks).To(HaveKeyWithValue("message-loop", statusOK))
+		Expect(response.Checks).To(HaveKeyWithValue("github-token", statusOK))
+	})
+
+	It("should report the failing check with 503", func() {
+		server.AddReadinessCheck("orka", passing)
+		server.AddReadinessCheck("session", failing)
+
+		code, response := probe("/readyz")
+
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(response.Status).To(Equal(statusFailed))
+		Expect(response.Checks).To(HaveKeyWithValue("orka", statusOK))
+		Expect(response.Checks).To(HaveKeyWithValue("session", "session expired"))
+	})
+
+	It("should keep liveness and readiness checks apart", func() {
+		server.AddReadinessCheck("session", failing)
+
+		code, _ := probe("/healthz")
+
+		Expect(code).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,185 @@
+package retryablehttp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
+)
+
+const (
+	// rateLimitMaxWait is the longest a request waits for a GitHub rate limit to reset before it fails with a
+	// RateLimitError. Primary rate limits reset up to an hour later, which is too long to block the callers.
+	rateLimitMaxWait = time.Minute
+	// secondaryRateLimitWait is the wait GitHub recommends for secondary rate limits that do not say how long to wait.
+	secondaryRateLimitWait = time.Minute
+)
+
+// RateLimitError is returned when GitHub rejects a request because a rate limit is exhausted and it does not reset soon
+// enough to retry the request.
+type RateLimitError struct {
+	StatusCode int
+	Resource   string
+	// RetryAfter is when the request may be sent again.
+	RetryAfter time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("GitHub rate limit of resource %s exceeded with status %d, retry after %s", e.Resource, e.StatusCode, e.RetryAfter.Format(time.RFC3339))
+}
+
+// isRateLimited reports whether GitHub rejected the request because of a primary or a secondary rate limit.
+func isRateLimited(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != ""
+	default:
+		return false
+	}
+}
+
+// rateLimitWait returns how long to wait before retrying a rate limited request, based on the Retry-After header, the
+// reset time of the rate limit, or the recommended wait for secondary rate limits.
+func rateLimitWait(resp *http.Response) time.Duration {
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if date, err := http.ParseTime(retryAfter); err == nil {
+			return max(time.Until(date), 0)
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			// The reset time has a precision of seconds, so wait an extra second
+			return max(time.Until(time.Unix(reset, 0)), 0) + time.Second
+		}
+	}
+
+	return secondaryRateLimitWait
+}
+
+func newRateLimitError(resp *http.Response) *RateLimitError {
+	return &RateLimitError{
+		StatusCode: resp.StatusCode,
+		Resource:   rateLimitResource(resp),
+		RetryAfter: time.Now().Add(rateLimitWait(resp)),
+	}
+}
+
+func rateLimitResource(resp *http.Response) string {
+	if resource := resp.Header.Get("X-RateLimit-Resource"); resource != "" {
+		return resource
+	}
+
+	return "unknown"
+}
+
+// recordRateLimit exposes the rate limit headroom that GitHub reports with every response.
+func recordRateLimit(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		metrics.GitHubRateLimitRemaining.WithLabelValues(rateLimitResource(resp)).Set(float64(remaining))
+	}
+
+	if isRateLimited(resp) {
+		metrics.GitHubRateLimited.WithLabelValues(rateLimitResource(resp)).Inc()
+	}
+}
+
+// tokenBucket limits the rate of the requests of all clients, so that the controller spreads its requests over the rate
+// limit window instead of exhausting the rate limit in bursts.
+type tokenBucket struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// limiter is shared by all clients. It is nil when the rate is not limited.
+var (
+	limiterMu sync.RWMutex
+	limiter   *tokenBucket
+)
+
+// SetRateLimit limits the requests of all clients to requestsPerHour, allowing bursts of up to burst requests. Zero
+// requests per hour removes the limit.
+func SetRateLimit(requestsPerHour, burst int) {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+
+	if requestsPerHour <= 0 {
+		limiter = nil
+		return
+	}
+
+	limiter = newTokenBucket(time.Hour/time.Duration(requestsPerHour), max(burst, 1))
+}
+
+func newTokenBucket(interval time.Duration, burst int) *tokenBucket {
+	return &tokenBucket{
+		interval: interval,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// waitForRateLimit blocks until the shared limiter allows another request or the context is canceled.
+func waitForRateLimit(ctx context.Context) error {
+	limiterMu.RLock()
+	bucket := limiter
+	limiterMu.RUnlock()
+
+	if bucket == nil {
+		return nil
+	}
+
+	return bucket.Wait(ctx)
+}
+
+// Wait takes a token and blocks until it is available. The token is taken right away, so that concurrent requests
+// queue up behind each other.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+float64(now.Sub(b.last))/float64(b.interval))
+	b.last = now
+	b.tokens--
+	wait := time.Duration(-b.tokens * float64(b.interval))
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		// Return the token, so that a canceled request does not slow down the others
+		b.mu.Lock()
+		b.tokens = math.Min(b.burst, b.tokens+1)
+		b.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -1,14 +1,20 @@
 package retryablehttp
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	retryable "github.com/hashicorp/go-retryablehttp"
 	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
+// baseTransport sends the requests and records a client span for every attempt.
+var baseTransport = otelhttp.NewTransport(http.DefaultTransport)
+
 type Client struct {
 	*http.Client
 
@@ -37,7 +43,14 @@ func (t *ClientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 		req.Header.Set("Accept", t.Accept)
 	}
 
-	return http.DefaultTransport.RoundTrip(req)
+	if err := waitForRateLimit(req.Context()); err != nil {
+		return nil, err
+	}
+
+	resp, err := baseTransport.RoundTrip(req)
+	recordRateLimit(resp)
+
+	return resp, err
 }
 
 func NewClient(transport *ClientTransport) (*Client, error) {
@@ -51,6 +64,9 @@ func NewClient(transport *ClientTransport) (*Client, error) {
 
 	retryClient.RetryMax = client.retryMax
 	retryClient.RetryWaitMax = client.retryWaitMax
+	retryClient.CheckRetry = checkRetry
+	retryClient.Backoff = backoff
+	retryClient.ErrorHandler = errorHandler
 	retryClient.HTTPClient.Timeout = 5 * time.Minute
 
 	retryClient.HTTPClient.Transport = transport
@@ -58,3 +74,49 @@ func NewClient(transport *ClientTransport) (*Client, error) {
 
 	return client, nil
 }
+
+// checkRetry retries rate limited requests when the rate limit resets within rateLimitMaxWait, and fails them with a
+// RateLimitError otherwise. Other requests are retried like go-retryablehttp does by default.
+func checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	if isRateLimited(resp) {
+		if rateLimitWait(resp) > rateLimitMaxWait {
+			return false, newRateLimitError(resp)
+		}
+		return true, nil
+	}
+
+	return retryable.DefaultRetryPolicy(ctx, resp, err)
+}
+
+// backoff waits for rate limits to reset, which may take longer than retryWaitMax, and backs off exponentially for
+// other failures.
+func backoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if isRateLimited(resp) {
+		return rateLimitWait(resp)
+	}
+
+	return retryable.DefaultBackoff(min, max, attemptNum, resp)
+}
+
+// errorHandler returns a RateLimitError when the retries ran out on a rate limit, and otherwise the same error as
+// go-retryablehttp does by default.
+func errorHandler(resp *http.Response, err error, numTries int) (*http.Response, error) {
+	if resp != nil {
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	}
+
+	if err == nil && isRateLimited(resp) {
+		err = newRateLimitError(resp)
+	}
+
+	if err == nil {
+		return nil, fmt.Errorf("giving up after %d attempt(s)", numTries)
+	}
+
+	return nil, fmt.Errorf("giving up after %d attempt(s): %w", numTries, err)
+}
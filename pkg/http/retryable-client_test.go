@@ -0,0 +1,127 @@
+package retryablehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHTTP(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HTTP Suite")
+}
+
+var _ = Describe("Client", func() {
+	var (
+		client   *Client
+		requests atomic.Int32
+	)
+
+	serve := func(handler http.HandlerFunc) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			handler(w, r)
+		}))
+		DeferCleanup(server.Close)
+
+		return server.URL
+	}
+
+	BeforeEach(func() {
+		logging.SetupLogger("info")
+		requests.Store(0)
+
+		var err error
+		client, err = NewClient(&ClientTransport{Token: "token", ContentType: "application/json"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should retry after the time GitHub asks for", func() {
+		url := serve(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Load() == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+
+		start := time.Now()
+		resp, err := client.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(requests.Load()).To(Equal(int32(2)))
+		Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+	})
+
+	It("should fail with a RateLimitError when the rate limit resets too late", func() {
+		reset := time.Now().Add(time.Hour).Unix()
+		url := serve(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+			w.Header().Set("X-RateLimit-Resource", "core")
+			w.WriteHeader(http.StatusForbidden)
+		})
+
+		_, err := client.Get(url)
+
+		var rateLimitErr *RateLimitError
+		Expect(errors.As(err, &rateLimitErr)).To(BeTrue())
+		Expect(rateLimitErr.Resource).To(Equal("core"))
+		Expect(rateLimitErr.RetryAfter).To(BeTemporally("~", time.Unix(reset, 0), 2*time.Second))
+		Expect(requests.Load()).To(Equal(int32(1)))
+		Expect(testutil.ToFloat64(metrics.GitHubRateLimitRemaining.WithLabelValues("core"))).To(BeZero())
+	})
+
+	It("should not retry forbidden requests that are not rate limited", func() {
+		url := serve(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			w.Header().Set("X-RateLimit-Resource", "core")
+			w.WriteHeader(http.StatusForbidden)
+		})
+
+		resp, err := client.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+		Expect(requests.Load()).To(Equal(int32(1)))
+		Expect(testutil.ToFloat64(metrics.GitHubRateLimitRemaining.WithLabelValues("core"))).To(Equal(4999.0))
+	})
+})
+
+var _ = Describe("tokenBucket", func() {
+	It("should allow bursts and then space the requests out", func() {
+		bucket := newTokenBucket(100*time.Millisecond, 2)
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			Expect(bucket.Wait(context.Background())).To(Succeed())
+		}
+
+		Expect(time.Since(start)).To(BeNumerically("~", 100*time.Millisecond, 50*time.Millisecond))
+	})
+
+	It("should stop waiting when the context is canceled", func() {
+		bucket := newTokenBucket(time.Hour, 1)
+		Expect(bucket.Wait(context.Background())).To(Succeed())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		Expect(bucket.Wait(ctx)).To(MatchError(context.DeadlineExceeded))
+	})
+})
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The collectors below are updated by the controller itself, as opposed to the scale set statistics reported by GitHub.
+
+// ProvisioningQueueDepth is the number of runners waiting for free Orka capacity in a namespace.
+var ProvisioningQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "orka_provisioning_queue_depth",
+	Help: "Number of runners waiting for free Orka capacity",
+}, []string{"namespace"})
+
+// VMDeployDuration is the time Orka takes to deploy a runner VM.
+var VMDeployDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "orka_vm_deploy_duration_seconds",
+	Help:    "Time taken to deploy an Orka VM",
+	Buckets: prometheus.ExponentialBuckets(5, 2, 8),
+}, []string{"namespace", "vm_config"})
+
+// SSHConnectDuration is the time until an SSH connection to a VM is established, including retries.
+var SSHConnectDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "orka_ssh_connect_duration_seconds",
+	Help:    "Time taken to connect to a VM over SSH, including retries",
+	Buckets: prometheus.ExponentialBuckets(0.5, 2, 10),
+})
+
+// JobStartDelay is the time from the job being assigned to the scale set until a runner started it.
+var JobStartDelay = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "github_job_assigned_to_started_seconds",
+	Help:    "Time from a job being assigned to the runner scale set until a runner started it",
+	Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+}, []string{"runner_name"})
+
+// JobDuration is the time a runner took to run a job.
+var JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "github_job_duration_seconds",
+	Help:    "Time from a runner starting a job until the job completed",
+	Buckets: prometheus.ExponentialBuckets(30, 2, 10),
+}, []string{"runner_name", "result"})
+
+// ProvisioningFailures counts runners that could not be provisioned, by the step that failed.
+var ProvisioningFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "orka_provisioning_failures_total",
+	Help: "Number of failed runner provisioning attempts by reason",
+}, []string{"runner_name", "reason"})
+
+const (
+	FailureReasonDeployVM   = "deploy_vm"
+	FailureReasonVMIP       = "vm_ip"
+	FailureReasonJITConfig  = "jit_config"
+	FailureReasonSSHConnect = "ssh_connect"
+	FailureReasonWarmPool   = "warm_pool_prepare"
+	FailureReasonPreJobHook = "pre_job_hook"
+)
+
+// OrphanedVMsDeleted counts VMs that were deleted because they had no GitHub runner.
+var OrphanedVMsDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "orka_orphaned_vms_deleted_total",
+	Help: "Number of VMs deleted because they had no GitHub runner",
+}, []string{"namespace", "source"})
+
+const (
+	OrphanSourceTracker = "tracker"
+	OrphanSourceSweeper = "sweeper"
+)
+
+// RunnersForceDeleted counts runners that did not de-register in time and were deleted from GitHub.
+var RunnersForceDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "github_runners_force_deleted_total",
+	Help: "Number of runners force-deleted from GitHub after they did not de-register",
+}, []string{"runner_name"})
+
+// TokenRefreshes counts refreshes of the GitHub Actions service token.
+var TokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "github_token_refreshes_total",
+	Help: "Number of GitHub Actions service token refreshes by result",
+}, []string{"result"})
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// GitHubRateLimitRemaining is the number of requests left in the current GitHub rate limit window, as last reported by
+// GitHub for the rate limit resource, such as `core`.
+var GitHubRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "github_rate_limit_remaining",
+	Help: "Number of GitHub API requests left in the current rate limit window",
+}, []string{"resource"})
+
+// GitHubRateLimited counts GitHub API responses that reported an exhausted rate limit.
+var GitHubRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "github_rate_limited_requests_total",
+	Help: "Number of GitHub API requests rejected because of a rate limit",
+}, []string{"resource"})
+
+// OwnedVMs is the number of VMs that the controller currently owns, from deployment until deletion.
+var OwnedVMs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "orka_owned_vms",
+	Help: "Number of Orka VMs currently owned by the controller",
+}, []string{"runner_name"})
+
+func controllerCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		ProvisioningQueueDepth,
+		VMDeployDuration,
+		SSHConnectDuration,
+		JobStartDelay,
+		JobDuration,
+		ProvisioningFailures,
+		OrphanedVMsDeleted,
+		RunnersForceDeleted,
+		TokenRefreshes,
+		GitHubRateLimitRemaining,
+		GitHubRateLimited,
+		OwnedVMs,
+	}
+}
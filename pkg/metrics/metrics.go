@@ -6,13 +6,17 @@ import (
 	"time"
 
 	"github.com/macstadium/orka-github-actions-integration/pkg/env"
-	"github.com/macstadium/orka-github-actions-integration/pkg/github/actions"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
+// ScaleSetClient is the part of the actions client that the poller needs.
+type ScaleSetClient interface {
+	GetRunnerScaleSet(ctx context.Context, runnerGroupId int, runnerScaleSetName string) (*types.RunnerScaleSet, error)
+}
+
 type Metrics struct {
 	registry *prometheus.Registry
 
@@ -76,6 +80,7 @@ func newMetrics() *Metrics {
 		m.totalBusyRunners,
 		m.totalIdleRunners,
 	)
+	registry.MustRegister(controllerCollectors()...)
 
 	return m
 }
@@ -84,9 +89,6 @@ func Start(
 	ctx context.Context,
 	logger *zap.SugaredLogger,
 	envData *env.Data,
-	actionsClient *actions.ActionsClient,
-	runnerName string,
-	groupId int,
 ) *Metrics {
 
 	m := newMetrics()
@@ -94,12 +96,21 @@ func Start(
 	// Start HTTP server
 	go m.startServer(ctx, logger, envData.MetricsAddr)
 
-	// Start poller
-	go m.startPoller(ctx, logger, envData.MetricsPollInterval, actionsClient, runnerName, groupId)
-
 	return m
 }
 
+// StartPoller starts polling the statistics of a single runner scale set.
+func (m *Metrics) StartPoller(
+	ctx context.Context,
+	logger *zap.SugaredLogger,
+	interval time.Duration,
+	actionsClient ScaleSetClient,
+	runnerName string,
+	groupId int,
+) {
+	go m.startPoller(ctx, logger, interval, actionsClient, runnerName, groupId)
+}
+
 func (m *Metrics) startServer(ctx context.Context, logger *zap.SugaredLogger, addr string) {
 	server := &http.Server{
 		Addr:    addr,
@@ -122,7 +133,7 @@ func (m *Metrics) startPoller(
 	ctx context.Context,
 	logger *zap.SugaredLogger,
 	interval time.Duration,
-	actionsClient *actions.ActionsClient,
+	actionsClient ScaleSetClient,
 	runnerName string,
 	groupId int,
 ) {
@@ -0,0 +1,134 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/macstadium/orka-github-actions-integration/pkg/api"
+	"github.com/macstadium/orka-github-actions-integration/pkg/env"
+)
+
+// OrkaAPIClient implements OrkaService on top of the Orka 3 REST API.
+type OrkaAPIClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func (client *OrkaAPIClient) DeployVM(ctx context.Context, options *DeployVMOptions) (*OrkaVMDeployResponseModel, error) {
+	body := &OrkaVMDeployRequestModel{
+		Name:         options.NamePrefix,
+		VMConfig:     options.VMConfig,
+		GenerateName: true,
+		Metadata:     options.metadata(),
+	}
+
+	return requestJSON[OrkaVMDeployRequestModel, OrkaVMDeployResponseModel](ctx, client, resourceOperation, http.MethodPost, client.vmsPath(options.Namespace), body)
+}
+
+func (client *OrkaAPIClient) DeleteVM(ctx context.Context, namespace, name string) error {
+	_, err := requestJSON[any, any](ctx, client, vmOperation, http.MethodDelete, fmt.Sprintf("%s/%s", client.vmsPath(namespace), url.PathEscape(name)), nil)
+
+	return err
+}
+
+func (client *OrkaAPIClient) GetVM(ctx context.Context, namespace, name string) (*OrkaVMResponseModel, error) {
+	return requestJSON[any, OrkaVMResponseModel](ctx, client, vmOperation, http.MethodGet, fmt.Sprintf("%s/%s", client.vmsPath(namespace), url.PathEscape(name)), nil)
+}
+
+func (client *OrkaAPIClient) ListVMs(ctx context.Context, namespace string) ([]*OrkaVMResponseModel, error) {
+	res, err := requestJSON[any, OrkaVMListResponseModel](ctx, client, resourceOperation, http.MethodGet, client.vmsPath(namespace), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil {
+		return []*OrkaVMResponseModel{}, nil
+	}
+
+	return res.Items, nil
+}
+
+func (client *OrkaAPIClient) ListNodes(ctx context.Context, namespace string) ([]*OrkaNodeResponseModel, error) {
+	res, err := requestJSON[any, OrkaNodeListResponseModel](ctx, client, resourceOperation, http.MethodGet, client.nodesPath(namespace), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil {
+		return []*OrkaNodeResponseModel{}, nil
+	}
+
+	return res.Items, nil
+}
+
+func (client *OrkaAPIClient) GetVMConfig(ctx context.Context, name string) (*OrkaVMConfigResponseModel, error) {
+	return requestJSON[any, OrkaVMConfigResponseModel](ctx, client, resourceOperation, http.MethodGet, fmt.Sprintf("%s/api/v1/vmconfigs/%s", client.baseURL, url.PathEscape(name)), nil)
+}
+
+func (client *OrkaAPIClient) nodesPath(namespace string) string {
+	return fmt.Sprintf("%s/api/v1/namespaces/%s/nodes", client.baseURL, url.PathEscape(namespace))
+}
+
+func (client *OrkaAPIClient) vmsPath(namespace string) string {
+	return fmt.Sprintf("%s/api/v1/namespaces/%s/vms", client.baseURL, url.PathEscape(namespace))
+}
+
+// requestJSON sends the request and retries it with a backoff while the Orka API throttles the requests.
+func requestJSON[Req any, Res any](ctx context.Context, client *OrkaAPIClient, op operation, method string, path string, body *Req) (*Res, error) {
+	request := func() (*Res, error) {
+		res, err := api.RequestJSON[Req, Res](ctx, client.httpClient, method, path, body)
+		if err != nil {
+			var httpErr *api.HTTPError
+			if errors.As(err, &httpErr) {
+				err = newOrkaError(op, httpErr.StatusCode, strings.TrimSpace(httpErr.Body))
+			}
+
+			if !errors.Is(err, ErrRateLimited) {
+				return nil, backoff.Permanent(err)
+			}
+
+			return nil, err
+		}
+
+		return res, nil
+	}
+
+	return backoff.RetryWithData(request, backoff.WithContext(newRateLimitBackOff(), ctx))
+}
+
+// newRateLimitBackOff returns the backoff for requests the Orka API throttles.
+var newRateLimitBackOff = func() backoff.BackOff {
+	return backoff.NewExponentialBackOff(backoff.WithMaxElapsedTime(time.Minute))
+}
+
+func newOrkaAPIClient(ctx context.Context, envData *env.Data) (*OrkaAPIClient, error) {
+	client := &OrkaAPIClient{
+		baseURL: envData.OrkaURL,
+		httpClient: &http.Client{
+			Transport: &OrkaTransport{
+				Token: envData.OrkaToken,
+			},
+			Timeout: 10 * time.Minute,
+		},
+	}
+
+	// The purpose of this call is to check the permissions of the provided token.
+	for _, namespace := range envData.Namespaces() {
+		_, err := client.ListNodes(ctx, namespace)
+		if err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				return nil, fmt.Errorf("the provided token is not valid for namespace %s. Please provide a valid token", namespace)
+			}
+
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
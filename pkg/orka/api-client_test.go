@@ -0,0 +1,170 @@
+package orka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestOrka(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Orka Suite")
+}
+
+var _ = Describe("OrkaAPIClient", func() {
+	var (
+		server  *httptest.Server
+		handler http.HandlerFunc
+		client  *OrkaAPIClient
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		defaultBackOff := newRateLimitBackOff
+		newRateLimitBackOff = func() backoff.BackOff { return backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Millisecond), 5) }
+		DeferCleanup(func() { newRateLimitBackOff = defaultBackOff })
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r)
+		}))
+		client = &OrkaAPIClient{
+			baseURL:    server.URL,
+			httpClient: &http.Client{Transport: &OrkaTransport{Token: "token"}},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should deploy a VM with a generated name and ownership metadata", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.URL.Path).To(Equal("/api/v1/namespaces/orka-test/vms"))
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer token"))
+
+			var body OrkaVMDeployRequestModel
+			Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+			Expect(body.Name).To(Equal("my-runner"))
+			Expect(body.VMConfig).To(Equal("sonoma"))
+			Expect(body.GenerateName).To(BeTrue())
+			Expect(body.Metadata).To(Equal(map[string]string{
+				"key1":                   "value1",
+				"key2":                   "value2",
+				ControllerMetadataKey:    "controller-1",
+				ScaleSetMetadataKey:      "my-runner",
+				ScaleSetIdMetadataKey:    "7",
+				RunnerGroupMetadataKey:   "1",
+				JobIdMetadataKey:         "job-1",
+				RunnerRequestMetadataKey: "42",
+			}))
+
+			_, _ = w.Write([]byte(`{"name":"my-runner-abcde","ip":"10.0.0.1","ssh":8822,"status":"Running"}`))
+		}
+
+		vm, err := client.DeployVM(ctx, &DeployVMOptions{
+			Namespace:  "orka-test",
+			NamePrefix: "my-runner",
+			VMConfig:   "sonoma",
+			Metadata:   "key1=value1, key2=value2, github-runner-controller=spoofed",
+			Ownership: VMOwnership{
+				ControllerId:    "controller-1",
+				ScaleSetId:      7,
+				ScaleSetName:    "my-runner",
+				RunnerGroupId:   1,
+				JobId:           "job-1",
+				RunnerRequestId: 42,
+			},
+		})
+
+		Expect(err).To(BeNil())
+		Expect(vm.Name).To(Equal("my-runner-abcde"))
+		Expect(*vm.SSH).To(Equal(8822))
+	})
+
+	It("should list VMs in a namespace", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/api/v1/namespaces/orka-test/vms"))
+			_, _ = w.Write([]byte(`{"items":[{"name":"vm-1"},{"name":"vm-2"}]}`))
+		}
+
+		vms, err := client.ListVMs(ctx, "orka-test")
+
+		Expect(err).To(BeNil())
+		Expect(vms).To(HaveLen(2))
+		Expect(vms[1].Name).To(Equal("vm-2"))
+	})
+
+	DescribeTable("should return typed errors",
+		func(statusCode int, body string, expected error) {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(statusCode)
+				_, _ = w.Write([]byte(body))
+			}
+
+			err := client.DeleteVM(ctx, "orka-test", "vm-1")
+
+			Expect(err).To(MatchError(expected))
+
+			var orkaErr *OrkaError
+			Expect(err).To(BeAssignableToTypeOf(orkaErr))
+		},
+		Entry("when the VM does not exist", http.StatusNotFound, `{"message":"vm-1 not found"}`, ErrVMNotFound),
+		Entry("when the namespace does not exist", http.StatusNotFound, `{"message":"namespaces \"orka-test\" not found"}`, ErrResourceNotFound),
+		Entry("when the token is invalid", http.StatusUnauthorized, `{"message":"Unauthorized"}`, ErrUnauthorized),
+		Entry("when the namespace quota is exhausted", http.StatusForbidden, `{"message":"exceeded quota: cpu"}`, ErrQuotaExceeded),
+		Entry("when the requests are throttled", http.StatusTooManyRequests, `{"message":"Too Many Requests"}`, ErrRateLimited),
+	)
+
+	It("should not report a missing VM config as a missing VM", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"sonoma not found"}`))
+		}
+
+		_, err := client.DeployVM(ctx, &DeployVMOptions{Namespace: "orka-test", NamePrefix: "my-runner", VMConfig: "sonoma"})
+		Expect(err).To(MatchError(ErrResourceNotFound))
+		Expect(err).NotTo(MatchError(ErrVMNotFound))
+
+		_, err = client.GetVMConfig(ctx, "sonoma")
+		Expect(err).To(MatchError(ErrResourceNotFound))
+	})
+
+	It("should retry throttled requests", func() {
+		requests := 0
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests < 3 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = w.Write([]byte(`{"name":"vm-1"}`))
+		}
+
+		vm, err := client.GetVM(ctx, "orka-test", "vm-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vm.Name).To(Equal("vm-1"))
+		Expect(requests).To(Equal(3))
+	})
+
+	It("should not retry other errors", func() {
+		requests := 0
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusNotFound)
+		}
+
+		_, err := client.GetVM(ctx, "orka-test", "vm-1")
+		Expect(err).To(MatchError(ErrVMNotFound))
+		Expect(requests).To(Equal(1))
+	})
+})
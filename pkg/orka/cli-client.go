@@ -0,0 +1,137 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/env"
+	"github.com/macstadium/orka-github-actions-integration/pkg/exec"
+)
+
+// OrkaCLIClient implements OrkaService by shelling out to the orka3 CLI.
+type OrkaCLIClient struct {
+	envData *env.Data
+}
+
+func (client *OrkaCLIClient) DeployVM(ctx context.Context, options *DeployVMOptions) (*OrkaVMDeployResponseModel, error) {
+	args := []string{"vm", "deploy", options.NamePrefix, "--config", options.VMConfig, "--generate-name", "-o", "json", "--namespace", options.Namespace}
+	if metadata := formatMetadata(options.metadata()); metadata != "" {
+		args = append(args, "--metadata", metadata)
+	}
+
+	res, err := exec.ExecJSONCommand[[]*OrkaVMDeployResponseModel]("orka3", args)
+	if err != nil {
+		return nil, wrapCLIError(resourceOperation, err)
+	}
+
+	return (*res)[0], nil
+}
+
+// DeleteVM deletes the VM and confirms it with the JSON output of the VM list, because the output of the delete
+// command is only meant to be read by humans.
+func (client *OrkaCLIClient) DeleteVM(ctx context.Context, namespace, name string) error {
+	if _, err := exec.ExecStringCommand("orka3", []string{"vm", "delete", name, "--namespace", namespace}); err != nil {
+		return wrapCLIError(vmOperation, err)
+	}
+
+	_, err := client.GetVM(ctx, namespace, name)
+	if errors.Is(err, ErrVMNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return &OrkaError{Message: fmt.Sprintf("vm %s still exists after it was deleted", name)}
+}
+
+func (client *OrkaCLIClient) GetVM(ctx context.Context, namespace, name string) (*OrkaVMResponseModel, error) {
+	res, err := exec.ExecJSONCommand[[]*OrkaVMResponseModel]("orka3", []string{"vm", "list", name, "-o", "json", "--namespace", namespace})
+	if err != nil {
+		return nil, wrapCLIError(vmOperation, err)
+	}
+
+	if len(*res) == 0 {
+		return nil, &OrkaError{Message: fmt.Sprintf("vm %s not found", name), kind: ErrVMNotFound}
+	}
+
+	return (*res)[0], nil
+}
+
+func (client *OrkaCLIClient) ListVMs(ctx context.Context, namespace string) ([]*OrkaVMResponseModel, error) {
+	res, err := exec.ExecJSONCommand[[]*OrkaVMResponseModel]("orka3", []string{"vm", "list", "-o", "json", "--namespace", namespace})
+	if err != nil {
+		return nil, wrapCLIError(resourceOperation, err)
+	}
+
+	return *res, nil
+}
+
+func (client *OrkaCLIClient) ListNodes(ctx context.Context, namespace string) ([]*OrkaNodeResponseModel, error) {
+	res, err := exec.ExecJSONCommand[[]*OrkaNodeResponseModel]("orka3", []string{"node", "list", "-o", "json", "--namespace", namespace})
+	if err != nil {
+		return nil, wrapCLIError(resourceOperation, err)
+	}
+
+	return *res, nil
+}
+
+func (client *OrkaCLIClient) GetVMConfig(ctx context.Context, name string) (*OrkaVMConfigResponseModel, error) {
+	res, err := exec.ExecJSONCommand[[]*OrkaVMConfigResponseModel]("orka3", []string{"vmconfig", "list", name, "-o", "json"})
+	if err != nil {
+		return nil, wrapCLIError(resourceOperation, err)
+	}
+
+	if len(*res) == 0 {
+		return nil, &OrkaError{Message: fmt.Sprintf("vm config %s not found", name), kind: ErrResourceNotFound}
+	}
+
+	return (*res)[0], nil
+}
+
+// wrapCLIError classifies a failed orka3 command by its output only, because the command line itself contains words
+// such as `--namespace` that would be mistaken for the reason of the failure.
+func wrapCLIError(op operation, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	message := err.Error()
+	output := message
+	if _, after, found := strings.Cut(message, "failed with output: "); found {
+		output = after
+	}
+
+	return &OrkaError{Message: message, kind: classifyError(op, 0, output)}
+}
+
+func newOrkaCLIClient(envData *env.Data) (*OrkaCLIClient, error) {
+	_, err := exec.ExecStringCommand("orka3", []string{"config", "set", "--api-url", envData.OrkaURL})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = exec.ExecStringCommand("orka3", []string{"user", "set-token", envData.OrkaToken})
+	if err != nil {
+		return nil, err
+	}
+
+	// The purpose of this call is to check the permissions of the provided token.
+	// If the command fails with an "Unauthorized" error, it indicates that the provided token is not valid.
+	for _, namespace := range envData.Namespaces() {
+		_, err = exec.ExecStringCommand("orka3", []string{"node", "list", "--namespace", namespace})
+		if err != nil {
+			if errors.Is(wrapCLIError(resourceOperation, err), ErrUnauthorized) {
+				return nil, fmt.Errorf("the provided token is not valid for namespace %s. Please provide a valid token", namespace)
+			}
+
+			return nil, err
+		}
+	}
+
+	return &OrkaCLIClient{
+		envData: envData,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package orka
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OrkaCLIClient", func() {
+	var client *OrkaCLIClient
+
+	// fakeCLI puts an orka3 script on the PATH that prints the output of `vm delete` and `vm list` and exits with
+	// their exit codes.
+	fakeCLI := func(deleteOutput string, deleteExit int, listOutput string, listExit int) {
+		dir := GinkgoT().TempDir()
+		script := "#!/bin/sh\n" +
+			"case \"$2\" in\n" +
+			"delete) printf '%s' '" + deleteOutput + "'; exit " + strconv.Itoa(deleteExit) + " ;;\n" +
+			"list) printf '%s' '" + listOutput + "'; exit " + strconv.Itoa(listExit) + " ;;\n" +
+			"esac\n"
+		Expect(os.WriteFile(filepath.Join(dir, "orka3"), []byte(script), 0o755)).To(Succeed())
+
+		path := os.Getenv("PATH")
+		DeferCleanup(os.Setenv, "PATH", path)
+		Expect(os.Setenv("PATH", dir+string(os.PathListSeparator)+path)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		client = &OrkaCLIClient{}
+	})
+
+	Describe("DeleteVM", func() {
+		It("should succeed once the VM is no longer listed", func() {
+			fakeCLI("Successfully deleted vm runner-abc12\n", 0, "[]", 0)
+
+			Expect(client.DeleteVM(context.Background(), "orka-default", "runner-abc12")).To(Succeed())
+		})
+
+		It("should not depend on the wording of the delete output", func() {
+			fakeCLI("vm runner-abc12 deleted\n", 0, "[]", 0)
+
+			Expect(client.DeleteVM(context.Background(), "orka-default", "runner-abc12")).To(Succeed())
+		})
+
+		It("should fail when the VM is still listed", func() {
+			fakeCLI("Successfully deleted vm runner-abc12\n", 0, `[{"name":"runner-abc12"}]`, 0)
+
+			Expect(client.DeleteVM(context.Background(), "orka-default", "runner-abc12")).To(MatchError(ContainSubstring("still exists")))
+		})
+
+		It("should fail when the VM list is not JSON", func() {
+			fakeCLI("Successfully deleted vm runner-abc12\n", 0, "unexpected output", 0)
+
+			Expect(client.DeleteVM(context.Background(), "orka-default", "runner-abc12")).To(HaveOccurred())
+		})
+
+		It("should classify a failed delete by its exit status", func() {
+			fakeCLI("Error: vm runner-abc12 not found\n", 1, "[]", 0)
+
+			Expect(client.DeleteVM(context.Background(), "orka-default", "runner-abc12")).To(MatchError(ErrVMNotFound))
+		})
+
+		It("should fail when the delete exits with an error", func() {
+			fakeCLI("Error: internal server error\n", 1, "[]", 0)
+
+			err := client.DeleteVM(context.Background(), "orka-default", "runner-abc12")
+			Expect(err).To(HaveOccurred())
+			Expect(err).NotTo(MatchError(ErrVMNotFound))
+		})
+	})
+})
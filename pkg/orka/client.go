@@ -4,47 +4,39 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/macstadium/orka-github-actions-integration/pkg/api"
 	"github.com/macstadium/orka-github-actions-integration/pkg/env"
-	"github.com/macstadium/orka-github-actions-integration/pkg/exec"
+)
+
+const (
+	OrkaClientBackendAPI = "api"
+	OrkaClientBackendCLI = "cli"
 )
 
 type OrkaService interface {
-	DeployVM(ctx context.Context, namePrefix, vmConfig string) (*OrkaVMDeployResponseModel, error)
-	DeleteVM(ctx context.Context, name string) error
-}
+	DeployVM(ctx context.Context, options *DeployVMOptions) (*OrkaVMDeployResponseModel, error)
+	DeleteVM(ctx context.Context, namespace, name string) error
+	GetVM(ctx context.Context, namespace, name string) (*OrkaVMResponseModel, error)
+	ListVMs(ctx context.Context, namespace string) ([]*OrkaVMResponseModel, error)
 
-type OrkaClient struct {
-	envData *env.Data
+	ListNodes(ctx context.Context, namespace string) ([]*OrkaNodeResponseModel, error)
+	GetVMConfig(ctx context.Context, name string) (*OrkaVMConfigResponseModel, error)
 }
 
-func (client *OrkaClient) DeployVM(ctx context.Context, namePrefix, vmConfig string) (*OrkaVMDeployResponseModel, error) {
-	args := []string{"vm", "deploy", namePrefix, "--config", vmConfig, "--generate-name", "-o", "json", "--namespace", client.envData.OrkaNamespace}
-	if client.envData.OrkaVMMetadata != "" {
-		args = append(args, "--metadata", client.envData.OrkaVMMetadata)
-	}
-
-	res, err := exec.ExecJSONCommand[[]*OrkaVMDeployResponseModel]("orka3", args)
-	if err != nil {
-		return nil, err
-	}
-
-	return (*res)[0], nil
+type DeployVMOptions struct {
+	Namespace  string
+	NamePrefix string
+	VMConfig   string
+	// Metadata is the user's key=value comma separated VM metadata. The Ownership metadata is added to it.
+	Metadata  string
+	Ownership VMOwnership
 }
 
-func (client *OrkaClient) DeleteVM(ctx context.Context, name string) error {
-	out, err := exec.ExecStringCommand("orka3", []string{"vm", "delete", name, "--namespace", client.envData.OrkaNamespace})
-	if out == fmt.Sprintf("Successfully deleted vm %s", name) {
-		return nil
-	}
-
-	return err
-}
-
-func NewOrkaClient(envData *env.Data, ctx context.Context) (*OrkaClient, error) {
+// NewOrkaClient verifies the connectivity to the Orka cluster and returns the
+// OrkaService implementation selected by the ORKA_CLIENT_BACKEND env.
+func NewOrkaClient(envData *env.Data, ctx context.Context) (OrkaService, error) {
 	// This request is designed to fail quickly if there is no connectivity to the cluster.
 	// The orka3 user set-token operation may take up to ~1 minute to fail, which is excessive.
 	client := &http.Client{
@@ -58,30 +50,12 @@ func NewOrkaClient(envData *env.Data, ctx context.Context) (*OrkaClient, error)
 		return nil, fmt.Errorf("failed to connect to the Orka cluster: %s", err.Error())
 	}
 
-	_, err = exec.ExecStringCommand("orka3", []string{"config", "set", "--api-url", envData.OrkaURL})
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = exec.ExecStringCommand("orka3", []string{"user", "set-token", envData.OrkaToken})
-	if err != nil {
-		return nil, err
-	}
-
-	// The purpose of this call is to check the permissions of the provided token.
-	// If the command fails with an "Unauthorized" error, it indicates that the provided token is not valid.
-	_, err = exec.ExecStringCommand("orka3", []string{"node", "list", "--namespace", envData.OrkaNamespace})
-	if err != nil {
-		if strings.Contains(err.Error(), "Unauthorized") {
-			return nil, fmt.Errorf("the provided token is not valid. Please provide a valid token")
-		}
-
-		return nil, err
+	switch envData.OrkaClientBackend {
+	case OrkaClientBackendCLI:
+		return newOrkaCLIClient(envData)
+	default:
+		return newOrkaAPIClient(ctx, envData)
 	}
-
-	return &OrkaClient{
-		envData: envData,
-	}, nil
 }
 
 type OrkaTransport struct {
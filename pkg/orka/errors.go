@@ -0,0 +1,98 @@
+package orka
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrVMNotFound = errors.New("orka VM not found")
+	// ErrResourceNotFound is returned when a resource the request refers to, such as the VM config, the namespace or the
+	// image, does not exist. Unlike ErrVMNotFound, it usually points to a configuration error.
+	ErrResourceNotFound = errors.New("orka VM config, namespace or image not found")
+	ErrQuotaExceeded    = errors.New("orka quota exceeded or not enough resources")
+	// ErrRateLimited is returned when the Orka API throttles the requests. The request may succeed when it is retried.
+	ErrRateLimited  = errors.New("orka API rate limit exceeded")
+	ErrUnauthorized = errors.New("orka token is not valid or has insufficient permissions")
+	ErrSSHConnect   = errors.New("unable to connect to the VM over SSH")
+	// ErrHostKeyMismatch is returned when the SSH host key of a VM does not match the known or pinned key.
+	ErrHostKeyMismatch = errors.New("SSH host key verification failed")
+)
+
+// OrkaError describes a failed Orka operation. It wraps one of the sentinel
+// errors above when the failure could be classified, so callers can use errors.Is.
+type OrkaError struct {
+	StatusCode int
+	Message    string
+
+	kind error
+}
+
+func (e *OrkaError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%d - Orka request failed: %s", e.StatusCode, e.Message)
+	}
+
+	return fmt.Sprintf("Orka request failed: %s", e.Message)
+}
+
+func (e *OrkaError) Unwrap() error {
+	return e.kind
+}
+
+// operation is the kind of Orka request that failed, which decides what a not found error means.
+type operation int
+
+const (
+	// vmOperation reads or deletes an existing VM, so a not found error means that the VM does not exist.
+	vmOperation operation = iota
+	// resourceOperation deploys a VM or reads other resources, so a not found error means that a VM config, namespace
+	// or image the request refers to does not exist.
+	resourceOperation
+)
+
+func newOrkaError(op operation, statusCode int, message string) *OrkaError {
+	return &OrkaError{
+		StatusCode: statusCode,
+		Message:    message,
+		kind:       classifyError(op, statusCode, message),
+	}
+}
+
+func classifyError(op operation, statusCode int, message string) error {
+	lower := strings.ToLower(message)
+
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusNotFound:
+		return classifyNotFound(op, lower)
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	}
+
+	switch {
+	case strings.Contains(lower, "unauthorized"):
+		return ErrUnauthorized
+	case strings.Contains(lower, "not found"):
+		return classifyNotFound(op, lower)
+	case strings.Contains(lower, "too many requests"), strings.Contains(lower, "rate limit"):
+		return ErrRateLimited
+	case strings.Contains(lower, "quota"), strings.Contains(lower, "insufficient"), strings.Contains(lower, "not enough"):
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// classifyNotFound tells a missing VM apart from a missing namespace, VM config or image. Requests for an existing VM
+// only refer to its namespace besides the VM itself.
+func classifyNotFound(op operation, message string) error {
+	if op != vmOperation || strings.Contains(message, "namespace") {
+		return ErrResourceNotFound
+	}
+
+	return ErrVMNotFound
+}
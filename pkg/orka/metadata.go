@@ -0,0 +1,103 @@
+package orka
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VM metadata keys that identify the controller and the runner a VM was deployed for.
+const (
+	ControllerMetadataKey    = "github-runner-controller"
+	ScaleSetMetadataKey      = "github-runner-scale-set"
+	ScaleSetIdMetadataKey    = "github-runner-scale-set-id"
+	RunnerGroupMetadataKey   = "github-runner-group-id"
+	JobIdMetadataKey         = "github-runner-job-id"
+	RunnerRequestMetadataKey = "github-runner-request-id"
+)
+
+// HostKeyMetadataKey is the VM metadata key of the pinned SSH host key of the VM's image.
+const HostKeyMetadataKey = "ssh-host-key"
+
+// VMOwnership identifies the controller instance, scale set and job a VM is deployed for.
+// The job is empty for VMs deployed before a job is assigned, for example, warm pool VMs.
+type VMOwnership struct {
+	ControllerId    string
+	ScaleSetId      int
+	ScaleSetName    string
+	RunnerGroupId   int
+	JobId           string
+	RunnerRequestId int64
+}
+
+// IsOwnedBy reports whether the VM metadata carries the ownership tag of the controller and scale set.
+func IsOwnedBy(vm *OrkaVMResponseModel, controllerId, scaleSetName string) bool {
+	return vm.Metadata[ControllerMetadataKey] == controllerId && vm.Metadata[ScaleSetMetadataKey] == scaleSetName
+}
+
+func (o *VMOwnership) metadata() map[string]string {
+	metadata := map[string]string{}
+
+	if o.ControllerId != "" {
+		metadata[ControllerMetadataKey] = o.ControllerId
+	}
+	if o.ScaleSetName != "" {
+		metadata[ScaleSetMetadataKey] = o.ScaleSetName
+	}
+	if o.ScaleSetId != 0 {
+		metadata[ScaleSetIdMetadataKey] = strconv.Itoa(o.ScaleSetId)
+	}
+	if o.RunnerGroupId != 0 {
+		metadata[RunnerGroupMetadataKey] = strconv.Itoa(o.RunnerGroupId)
+	}
+	if o.JobId != "" {
+		metadata[JobIdMetadataKey] = o.JobId
+	}
+	if o.RunnerRequestId != 0 {
+		metadata[RunnerRequestMetadataKey] = strconv.FormatInt(o.RunnerRequestId, 10)
+	}
+
+	return metadata
+}
+
+// metadata merges the user's metadata with the ownership metadata. The ownership keys take precedence.
+func (options *DeployVMOptions) metadata() map[string]string {
+	metadata := parseMetadata(options.Metadata)
+	for key, value := range options.Ownership.metadata() {
+		metadata[key] = value
+	}
+
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	return metadata
+}
+
+// parseMetadata converts the key=value comma separated metadata string into a map.
+func parseMetadata(metadata string) map[string]string {
+	result := map[string]string{}
+	if metadata == "" {
+		return result
+	}
+
+	for _, pair := range strings.Split(metadata, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if found && key != "" {
+			result[key] = value
+		}
+	}
+
+	return result
+}
+
+// formatMetadata converts the metadata map into a key=value comma separated string, sorted by key.
+func formatMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
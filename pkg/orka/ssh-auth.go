@@ -0,0 +1,64 @@
+package orka
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KnownHostsCallback verifies host keys against the known_hosts file at path. Orka assigns the SSH port of a VM when it
+// is deployed, so the entries are matched by host only, as if the VM listened on port 22. VMs also get a new IP every
+// time, so the entries usually use a wildcard host pattern, for example, `* ssh-ed25519 AAAA...`.
+func KnownHostsCallback(path string) (ssh.HostKeyCallback, error) {
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read known_hosts file %s: %w", path, err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		host, _, err := net.SplitHostPort(hostname)
+		if err != nil {
+			host = hostname
+		}
+
+		if err := callback(net.JoinHostPort(host, "22"), remote, key); err != nil {
+			return fmt.Errorf("%w: %s presented %s key %s, which is not in %s: %v", ErrHostKeyMismatch, hostname, key.Type(), ssh.FingerprintSHA256(key), path, err)
+		}
+
+		return nil
+	}, nil
+}
+
+// PinnedHostKeyCallback verifies host keys against a single pinned key. The pinned key is either a public key in the
+// authorized_keys format, for example, `ssh-ed25519 AAAA...`, or its SHA256 fingerprint, for example, `SHA256:...`.
+func PinnedHostKeyCallback(pinned string) (ssh.HostKeyCallback, error) {
+	pinned = strings.TrimSpace(pinned)
+
+	matches := func(key ssh.PublicKey) bool {
+		return ssh.FingerprintSHA256(key) == pinned
+	}
+
+	if !strings.HasPrefix(pinned, "SHA256:") {
+		pinnedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pinned))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse pinned host key %q: %w", pinned, err)
+		}
+
+		pinned = ssh.FingerprintSHA256(pinnedKey)
+		matches = func(key ssh.PublicKey) bool {
+			return bytes.Equal(key.Marshal(), pinnedKey.Marshal())
+		}
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if !matches(key) {
+			return fmt.Errorf("%w: %s presented %s key %s, expected %s", ErrHostKeyMismatch, hostname, key.Type(), ssh.FingerprintSHA256(key), pinned)
+		}
+
+		return nil
+	}, nil
+}
@@ -0,0 +1,90 @@
+package orka
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+)
+
+var _ = Describe("Host key verification", func() {
+	var (
+		hostKey  ssh.PublicKey
+		otherKey ssh.PublicKey
+		remote   = &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8822}
+	)
+
+	newKey := func() ssh.PublicKey {
+		public, _, err := ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		key, err := ssh.NewPublicKey(public)
+		Expect(err).NotTo(HaveOccurred())
+
+		return key
+	}
+
+	BeforeEach(func() {
+		hostKey = newKey()
+		otherKey = newKey()
+	})
+
+	Describe("with a pinned key", func() {
+		It("should accept the pinned key in the authorized_keys format", func() {
+			callback, err := PinnedHostKeyCallback(string(ssh.MarshalAuthorizedKey(hostKey)))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(callback("10.0.0.1:8822", remote, hostKey)).To(Succeed())
+		})
+
+		It("should accept the pinned fingerprint", func() {
+			callback, err := PinnedHostKeyCallback(ssh.FingerprintSHA256(hostKey))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(callback("10.0.0.1:8822", remote, hostKey)).To(Succeed())
+		})
+
+		It("should reject a different key", func() {
+			callback, err := PinnedHostKeyCallback(ssh.FingerprintSHA256(hostKey))
+			Expect(err).NotTo(HaveOccurred())
+
+			err = callback("10.0.0.1:8822", remote, otherKey)
+			Expect(err).To(MatchError(ErrHostKeyMismatch))
+			Expect(err.Error()).To(ContainSubstring(ssh.FingerprintSHA256(otherKey)))
+			Expect(err.Error()).To(ContainSubstring(ssh.FingerprintSHA256(hostKey)))
+		})
+
+		It("should reject an invalid pinned key", func() {
+			_, err := PinnedHostKeyCallback("not-a-key")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("with a known_hosts file", func() {
+		var path string
+
+		BeforeEach(func() {
+			path = filepath.Join(GinkgoT().TempDir(), "known_hosts")
+			Expect(os.WriteFile(path, []byte("* "+string(ssh.MarshalAuthorizedKey(hostKey))), 0o600)).To(Succeed())
+		})
+
+		It("should accept a known key for any VM address", func() {
+			callback, err := KnownHostsCallback(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(callback("10.0.0.1:8822", remote, hostKey)).To(Succeed())
+		})
+
+		It("should reject an unknown key", func() {
+			callback, err := KnownHostsCallback(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(callback("10.0.0.1:8822", remote, otherKey)).To(MatchError(ErrHostKeyMismatch))
+		})
+	})
+})
@@ -12,6 +12,27 @@ type OrkaVMDeployResponseModel struct {
 	PortWarnings string  `json:"portWarnings,omitempty"`
 }
 
+type OrkaVMResponseModel struct {
+	Name     string            `json:"name"`
+	Node     string            `json:"node"`
+	IP       string            `json:"ip"`
+	SSH      *int              `json:"ssh,omitempty"`
+	VMConfig string            `json:"vmConfig,omitempty"`
+	Status   VMPhase           `json:"status"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type OrkaVMListResponseModel struct {
+	Items []*OrkaVMResponseModel `json:"items"`
+}
+
+type OrkaVMDeployRequestModel struct {
+	Name         string            `json:"name"`
+	VMConfig     string            `json:"vmConfig"`
+	GenerateName bool              `json:"generateName"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
 type VMPhase string
 
 const (
@@ -27,9 +48,27 @@ type OrkaVMConfigResponseModel struct {
 	Name  string `json:"name"`
 	Image string `json:"image"`
 	CPU   int    `json:"cpu"`
-	Type  string `json:"type"`
+	// Memory is the memory of the VMs in gigabytes. It is zero when Orka derives it from the CPU count.
+	Memory float64 `json:"memory,omitempty"`
+	Type   string  `json:"type"`
 }
 
+type OrkaNodeResponseModel struct {
+	Name            string `json:"name"`
+	NodeIP          string `json:"nodeIP"`
+	AvailableCPU    int    `json:"availableCpu"`
+	AllocatableCPU  int    `json:"allocatableCpu"`
+	AvailableMemory string `json:"availableMemory"`
+	Phase           string `json:"phase"`
+}
+
+type OrkaNodeListResponseModel struct {
+	Items []*OrkaNodeResponseModel `json:"items"`
+}
+
+// NodeReady is the phase of a node that can accept new VMs
+const NodeReady = "READY"
+
 type OrkaImageResponseModel struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
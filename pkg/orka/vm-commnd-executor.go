@@ -10,6 +10,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
+	"github.com/macstadium/orka-github-actions-integration/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/ssh"
 )
@@ -18,9 +22,14 @@ type VMCommandExecutor struct {
 	VMIP       string
 	VMPort     int
 	VMName     string
+	VMNode     string
 	VMUsername string
 	VMPassword string
-	Logger     *zap.SugaredLogger
+	// VMSigner is the optional private key for public key authentication. The password is tried when the key is rejected.
+	VMSigner ssh.Signer
+	// HostKeyCallback verifies the host key of the VM. Any host key is accepted when it is nil.
+	HostKeyCallback ssh.HostKeyCallback
+	Logger          *zap.SugaredLogger
 }
 
 const (
@@ -30,13 +39,18 @@ const (
 func (executor *VMCommandExecutor) ExecuteCommands(ctx context.Context, commands ...string) error {
 	executor.Logger.Infof("Starting execution on VM: %s (%s:%d)", executor.VMName, executor.VMIP, executor.VMPort)
 
-	sshConfig := &ssh.ClientConfig{
-		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	hostKeyCallback := executor.HostKeyCallback
+	if hostKeyCallback == nil {
+		hostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 			return nil
-		},
-		User:    executor.VMUsername,
-		Auth:    []ssh.AuthMethod{ssh.Password(executor.VMPassword)},
-		Timeout: time.Second * 10,
+		}
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		HostKeyCallback: hostKeyCallback,
+		User:            executor.VMUsername,
+		Auth:            executor.authMethods(),
+		Timeout:         time.Second * 10,
 	}
 
 	client, err := executor.connectWithRetries(ctx, sshConfig, fmt.Sprintf("%s:%d", executor.VMIP, executor.VMPort))
@@ -124,6 +138,20 @@ func (executor *VMCommandExecutor) ExecuteCommands(ctx context.Context, commands
 	}
 }
 
+func (executor *VMCommandExecutor) authMethods() []ssh.AuthMethod {
+	methods := []ssh.AuthMethod{}
+
+	if executor.VMSigner != nil {
+		methods = append(methods, ssh.PublicKeys(executor.VMSigner))
+	}
+
+	if executor.VMPassword != "" {
+		methods = append(methods, ssh.Password(executor.VMPassword))
+	}
+
+	return methods
+}
+
 type FormatFunc func(string) string
 
 func printFormattedOutput(logger *zap.SugaredLogger, streamName string, reader io.Reader, format FormatFunc) {
@@ -140,8 +168,15 @@ func printFormattedOutput(logger *zap.SugaredLogger, streamName string, reader i
 	}
 }
 
-func (executor *VMCommandExecutor) connectWithRetries(ctx context.Context, cfg *ssh.ClientConfig, addr string) (*ssh.Client, error) {
+func (executor *VMCommandExecutor) connectWithRetries(ctx context.Context, cfg *ssh.ClientConfig, addr string) (client *ssh.Client, err error) {
+	start := time.Now()
+
+	ctx, span := tracing.Tracer().Start(ctx, "SSHConnect", trace.WithAttributes(tracing.RunnerNameKey.String(executor.VMName)))
+	defer func() { tracing.End(span, err) }()
+
 	for attempt := 1; attempt <= maxRetries; attempt++ {
+		span.SetAttributes(attribute.Int("ssh.attempts", attempt))
+
 		if ctx.Err() != nil {
 			executor.Logger.Warnf("Context canceled during connection retry loop: %v", ctx.Err())
 			return nil, ctx.Err()
@@ -150,9 +185,16 @@ func (executor *VMCommandExecutor) connectWithRetries(ctx context.Context, cfg *
 		client, err := ssh.Dial("tcp", addr, cfg)
 		if err == nil {
 			executor.Logger.Infof("Connected to %s on attempt %d", addr, attempt)
+			metrics.SSHConnectDuration.Observe(time.Since(start).Seconds())
 			return client, nil
 		}
 
+		if errors.Is(err, ErrHostKeyMismatch) {
+			// Retrying does not help, the VM keeps presenting the same key
+			executor.Logger.Errorf("Refusing to connect to VM %s: %v", executor.VMName, err)
+			return nil, err
+		}
+
 		executor.Logger.Warnf("Failed to connect to VM (attempt %d/%d): %v", attempt, maxRetries, err)
 
 		select {
@@ -163,7 +205,7 @@ func (executor *VMCommandExecutor) connectWithRetries(ctx context.Context, cfg *
 		}
 	}
 
-	err := fmt.Errorf("failed to connect to VM after %d attempts", maxRetries)
+	err = fmt.Errorf("%w after %d attempts", ErrSSHConnect, maxRetries)
 	executor.Logger.Errorf("%v", err)
 	return nil, err
 }
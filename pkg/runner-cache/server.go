@@ -0,0 +1,207 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Architectures are the runner architectures the cache serves, as named in the runner tarballs.
+var Architectures = []string{"arm64", "x64"}
+
+// ErrChecksumMismatch is returned when a downloaded tarball does not match its configured SHA-256 checksum.
+var ErrChecksumMismatch = errors.New("runner tarball checksum mismatch")
+
+const downloadTimeout = 10 * time.Minute
+
+// Server serves the runner tarballs of one runner version to the VMs with the same paths as the GitHub releases, for
+// example, /v2.320.0/actions-runner-osx-arm64-2.320.0.tar.gz. A tarball is downloaded from the upstream URL the first
+// time it is requested and kept in the cache directory afterwards.
+type Server struct {
+	dir       string
+	upstream  string
+	version   string
+	checksums map[string]string
+	client    *http.Client
+	logger    *zap.SugaredLogger
+
+	mu        sync.Mutex
+	downloads map[string]chan struct{}
+}
+
+// NewServer creates a cache for the runner version. The checksums are the expected SHA-256 sums of the tarballs by
+// architecture. Tarballs of architectures without a checksum are not verified.
+func NewServer(dir, upstream, version string, checksums map[string]string, logger *zap.SugaredLogger) *Server {
+	return &Server{
+		dir:       dir,
+		upstream:  upstream,
+		version:   version,
+		checksums: checksums,
+		client:    &http.Client{Timeout: downloadTimeout},
+		logger:    logger.Named("runner-cache"),
+		downloads: map[string]chan struct{}{},
+	}
+}
+
+// TarballName returns the file name of the runner tarball for the architecture and version.
+func TarballName(arch, version string) string {
+	return fmt.Sprintf("actions-runner-osx-%s-%s.tar.gz", arch, version)
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	for _, arch := range Architectures {
+		name := TarballName(arch, s.version)
+		mux.HandleFunc(fmt.Sprintf("GET /v%s/%s", s.version, name), func(w http.ResponseWriter, r *http.Request) {
+			path, err := s.fetch(r.Context(), name, arch)
+			if err != nil {
+				s.logger.Errorf("unable to serve %s: %v", name, err)
+				http.Error(w, "runner tarball is not available", http.StatusBadGateway)
+				return
+			}
+
+			http.ServeFile(w, r, path)
+		})
+	}
+
+	return mux
+}
+
+// Start downloads the tarballs of all architectures in the background and serves them until the context is canceled.
+func (s *Server) Start(ctx context.Context, addr string) {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: s.Handler(),
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	go s.prefetch(ctx)
+
+	s.logger.Infof("runner cache for version %s available at %s", s.version, addr)
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.logger.Errorf("runner cache server failed: %v", err)
+	}
+}
+
+func (s *Server) prefetch(ctx context.Context) {
+	for _, arch := range Architectures {
+		name := TarballName(arch, s.version)
+		if _, err := s.fetch(ctx, name, arch); err != nil && ctx.Err() == nil {
+			s.logger.Warnf("unable to prefetch %s, retrying when a VM requests it: %v", name, err)
+		}
+	}
+}
+
+// fetch returns the path of the cached tarball and downloads it first if needed. Concurrent requests for the same
+// tarball wait for a single download.
+func (s *Server) fetch(ctx context.Context, name, arch string) (string, error) {
+	path := filepath.Join(s.dir, "v"+s.version, name)
+
+	for {
+		s.mu.Lock()
+		if _, err := os.Stat(path); err == nil {
+			s.mu.Unlock()
+			return path, nil
+		}
+
+		done, downloading := s.downloads[name]
+		if !downloading {
+			done = make(chan struct{})
+			s.downloads[name] = done
+		}
+		s.mu.Unlock()
+
+		if downloading {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-done:
+				if _, err := os.Stat(path); err != nil {
+					return "", fmt.Errorf("download of %s failed", name)
+				}
+				return path, nil
+			}
+		}
+
+		// The download is shared, so it must not be canceled when the VM that requested it disconnects
+		err := s.download(context.WithoutCancel(ctx), path, name, arch)
+
+		s.mu.Lock()
+		delete(s.downloads, name)
+		close(done)
+		s.mu.Unlock()
+
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func (s *Server) download(ctx context.Context, path, name, arch string) error {
+	url := fmt.Sprintf("%s/v%s/%s", s.upstream, s.version, name)
+	s.logger.Infof("downloading %s", url)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to download %s: %s", url, response.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), response.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to download %s: %w", url, err)
+	}
+
+	if expected := s.checksums[arch]; expected != "" {
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+			return fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksumMismatch, url, actual, expected)
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	s.logger.Infof("cached %s at %s", name, path)
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+func TestCache(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Runner Cache Suite")
+}
+
+var _ = Describe("Server", func() {
+	const (
+		version = "2.320.0"
+		tarball = "runner tarball"
+	)
+
+	var (
+		upstream  *httptest.Server
+		downloads atomic.Int32
+		checksums map[string]string
+	)
+
+	request := func(handler http.Handler, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	BeforeEach(func() {
+		downloads.Store(0)
+		upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v2.320.0/actions-runner-osx-arm64-2.320.0.tar.gz" {
+				http.NotFound(w, r)
+				return
+			}
+			downloads.Add(1)
+			_, _ = w.Write([]byte(tarball))
+		}))
+		DeferCleanup(upstream.Close)
+
+		sum := sha256.Sum256([]byte(tarball))
+		checksums = map[string]string{"arm64": hex.EncodeToString(sum[:])}
+	})
+
+	It("should download a tarball once and serve it from the cache afterwards", func() {
+		handler := NewServer(GinkgoT().TempDir(), upstream.URL, version, checksums, zap.NewNop().Sugar()).Handler()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				rec := request(handler, "/v2.320.0/actions-runner-osx-arm64-2.320.0.tar.gz")
+				Expect(rec.Code).To(Equal(http.StatusOK))
+				Expect(rec.Body.String()).To(Equal(tarball))
+			}()
+		}
+		wg.Wait()
+
+		Expect(downloads.Load()).To(Equal(int32(1)))
+	})
+
+	It("should not cache a tarball that does not match its checksum", func() {
+		checksums["arm64"] = "0000"
+		handler := NewServer(GinkgoT().TempDir(), upstream.URL, version, checksums, zap.NewNop().Sugar()).Handler()
+
+		Expect(request(handler, "/v2.320.0/actions-runner-osx-arm64-2.320.0.tar.gz").Code).To(Equal(http.StatusBadGateway))
+		Expect(request(handler, "/v2.320.0/actions-runner-osx-arm64-2.320.0.tar.gz").Code).To(Equal(http.StatusBadGateway))
+		Expect(downloads.Load()).To(Equal(int32(2)))
+	})
+
+	It("should only serve the tarballs of the configured version", func() {
+		handler := NewServer(GinkgoT().TempDir(), upstream.URL, version, checksums, zap.NewNop().Sugar()).Handler()
+
+		Expect(request(handler, "/v2.319.0/actions-runner-osx-arm64-2.319.0.tar.gz").Code).To(Equal(http.StatusNotFound))
+		Expect(request(handler, "/v2.320.0/../../etc/passwd").Code).NotTo(Equal(http.StatusOK))
+		Expect(downloads.Load()).To(BeZero())
+	})
+})
@@ -0,0 +1,152 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
+	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+)
+
+// defaultBootstrapTemplate downloads and extracts the runner in `prepare` and starts it in `run`. Warm pool VMs run
+// `prepare` ahead of time. The exit code of the runner is kept in RUNNER_EXIT_CODE, so that the post-job hooks run
+// even when the runner fails.
+const defaultBootstrapTemplate = `{{define "prepare" -}}
+set -e
+RUNNER_ARCH=$(uname -m | sed 's/86_//')
+RUNNER_URL={{.RunnerDownloadURL}}/v{{.RunnerVersion}}/actions-runner-osx-$RUNNER_ARCH-{{.RunnerVersion}}.tar.gz
+echo "Downloading Git Action Runner from $RUNNER_URL"
+mkdir -p /Users/{{.Username}}/actions-runner
+curl -f -o /Users/{{.Username}}/actions-runner/actions-runner.tar.gz -L $RUNNER_URL
+echo 'Git Action Runner download completed'
+{{- if .RunnerChecksums}}
+case $RUNNER_ARCH in
+{{- range $arch, $checksum := .RunnerChecksums}}
+{{$arch}}) RUNNER_SHA256={{$checksum}} ;;
+{{- end}}
+*) echo "No SHA-256 checksum is configured for the $RUNNER_ARCH runner"; exit 1 ;;
+esac
+echo "$RUNNER_SHA256  /Users/{{.Username}}/actions-runner/actions-runner.tar.gz" | shasum -a 256 -c -
+echo 'Git Action Runner checksum verified'
+{{- end}}
+echo 'Unarchiving Git Action Runner /Users/{{.Username}}/actions-runner/actions-runner.tar.gz'
+cd /Users/{{.Username}}/actions-runner
+tar xzf /Users/{{.Username}}/actions-runner/actions-runner.tar.gz
+echo 'Git Action Runner unarchive completed'
+{{- end}}
+{{define "run" -}}
+set -e
+echo 'Starting Git Action Runner'
+RUNNER_EXIT_CODE=0
+/Users/{{.Username}}/actions-runner/run.sh --jitconfig {{.JITConfig}} || RUNNER_EXIT_CODE=$?
+echo "Git Action Runner exited with code $RUNNER_EXIT_CODE"
+{{- end}}`
+
+var defaultBootstrap = template.Must(template.New("default").Option("missingkey=error").Parse(defaultBootstrapTemplate))
+
+// TemplateData is the data the bootstrap template and the hook scripts are templated with. The job fields are empty
+// for idle runners and warm pool VMs, and JITConfig is only set for the `run` part of the bootstrap template.
+type TemplateData struct {
+	JITConfig     string
+	RunnerVersion string
+	// RunnerDownloadURL is the base URL the runner tarballs are downloaded from, which is either the runner releases on
+	// GitHub, a mirror, or the runner cache of the controller.
+	RunnerDownloadURL string
+	// RunnerChecksums are the expected SHA-256 checksums of the runner tarballs by architecture, `arm64` or `x64`.
+	RunnerChecksums map[string]string
+	Username        string
+	VMName          string
+	Node            string
+	JobId           string
+	Labels          []string
+	Repository      string
+	WorkflowRef     string
+}
+
+// bootstrap splits the bootstrap template of the runner into the part that prepares the VM and the part that starts
+// the runner. A template that does not define `run` is run as a whole when the runner starts.
+func (p *RunnerProvisioner) bootstrap() (prepare, run *template.Template) {
+	bootstrap := p.runner.BootstrapTemplate
+	if bootstrap == nil {
+		bootstrap = defaultBootstrap
+	}
+
+	if run := bootstrap.Lookup("run"); run != nil {
+		return bootstrap.Lookup("prepare"), run
+	}
+
+	return nil, bootstrap
+}
+
+// runnerCommands renders the bootstrap template that starts the runner, followed by the post-job hooks. The `prepare`
+// part is skipped for VMs that are already prepared. The post-job hooks run even when the runner fails, as long as the
+// bootstrap template keeps its exit code in RUNNER_EXIT_CODE, and the commands exit with that exit code.
+func (p *RunnerProvisioner) runnerCommands(executor *orka.VMCommandExecutor, jitConfig string, job *types.JobMessageBase, prepared bool) ([]string, error) {
+	prepare, run := p.bootstrap()
+	data := p.templateData(executor.VMName, executor.VMNode, job)
+
+	commands := []string{}
+	if !prepared && prepare != nil {
+		script, err := renderScript(prepare, data)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, script)
+	}
+
+	postJobHooks, err := hookCommands("post-job", p.runner.PostJobHookTemplates, data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	data.JITConfig = jitConfig
+	script, err := renderScript(run, data)
+	if err != nil {
+		return nil, err
+	}
+
+	commands = append(append(commands, script), postJobHooks...)
+
+	return append(commands, "exit ${RUNNER_EXIT_CODE:-0}"), nil
+}
+
+func (p *RunnerProvisioner) templateData(runnerName, node string, job *types.JobMessageBase) *TemplateData {
+	data := &TemplateData{
+		RunnerVersion:     p.envData.GitHubRunnerVersion,
+		RunnerDownloadURL: p.envData.RunnerDownloadURL,
+		RunnerChecksums:   p.envData.RunnerSHA256Checksums,
+		Username:          p.runner.OrkaVMUsername,
+		VMName:            runnerName,
+		Node:              node,
+	}
+
+	if p.envData.EnableRunnerCache {
+		data.RunnerDownloadURL = p.envData.RunnerCacheURL
+	}
+
+	if job != nil {
+		data.JobId = job.JobId
+		data.Labels = job.RequestLabels
+		data.WorkflowRef = job.JobWorkflowRef
+		if job.RepositoryName != "" {
+			data.Repository = fmt.Sprintf("%s/%s", job.OwnerName, job.RepositoryName)
+		}
+	}
+
+	return data
+}
+
+// renderScript renders one part of the bootstrap template. A missing part renders to an empty script.
+func renderScript(script *template.Template, data *TemplateData) (string, error) {
+	if script == nil {
+		return "", nil
+	}
+
+	var result strings.Builder
+	if err := script.Execute(&result, data); err != nil {
+		return "", fmt.Errorf("unable to render bootstrap template %s: %w", script.Name(), err)
+	}
+
+	return result.String(), nil
+}
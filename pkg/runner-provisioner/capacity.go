@@ -0,0 +1,275 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
+	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+	"go.uber.org/zap"
+)
+
+type capacityRequest struct {
+	vmConfig string
+	granted  chan struct{}
+}
+
+// CapacityManager queues VM deployments in a namespace until Orka reports enough free capacity for them.
+//
+// Requests are granted in FIFO order. A granted request is counted as reserved until Release is called, so that
+// deployments that have not been scheduled on a node yet are not handed out twice.
+type CapacityManager struct {
+	orkaClient orka.OrkaService
+	namespace  string
+	interval   time.Duration
+	logger     *zap.SugaredLogger
+
+	mu        sync.Mutex
+	queue     []*capacityRequest
+	reserved  int
+	vmConfigs map[string]*orka.OrkaVMConfigResponseModel
+
+	wake chan struct{}
+}
+
+func NewCapacityManager(orkaClient orka.OrkaService, namespace string, interval time.Duration) *CapacityManager {
+	return &CapacityManager{
+		orkaClient: orkaClient,
+		namespace:  namespace,
+		interval:   interval,
+		logger:     logging.Logger.Named(fmt.Sprintf("capacity-%s", namespace)),
+		vmConfigs:  map[string]*orka.OrkaVMConfigResponseModel{},
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Start grants queued requests whenever capacity may have changed, until the context is canceled.
+func (c *CapacityManager) Start(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.wake:
+		}
+	}
+}
+
+// Acquire blocks until there is capacity to deploy one VM with the given config. Release must be called once the deployment has finished.
+func (c *CapacityManager) Acquire(ctx context.Context, vmConfig string) error {
+	request := &capacityRequest{
+		vmConfig: vmConfig,
+		granted:  make(chan struct{}),
+	}
+
+	c.mu.Lock()
+	c.queue = append(c.queue, request)
+	depth := c.updateQueueDepth()
+	c.mu.Unlock()
+
+	if depth > 1 {
+		c.logger.Infof("waiting for Orka capacity in namespace %s, %d runners in queue", c.namespace, depth)
+	}
+
+	c.Notify()
+
+	select {
+	case <-request.granted:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		removed := c.remove(request)
+		c.mu.Unlock()
+
+		if !removed {
+			c.Release()
+		}
+		return ctx.Err()
+	}
+}
+
+// Release returns a reservation taken by Acquire.
+func (c *CapacityManager) Release() {
+	c.mu.Lock()
+	if c.reserved > 0 {
+		c.reserved--
+	}
+	c.mu.Unlock()
+
+	c.Notify()
+}
+
+// Notify asks the manager to check capacity again, for example after a VM was deleted.
+func (c *CapacityManager) Notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// QueueDepth returns the number of requests waiting for capacity.
+func (c *CapacityManager) QueueDepth() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.queue)
+}
+
+func (c *CapacityManager) dispatch(ctx context.Context) {
+	for {
+		c.mu.Lock()
+		if len(c.queue) == 0 {
+			c.mu.Unlock()
+			return
+		}
+		head := c.queue[0]
+		reserved := c.reserved
+		c.mu.Unlock()
+
+		free, err := c.freeSlots(ctx, head.vmConfig)
+		if err != nil {
+			c.logger.Warnf("unable to check Orka capacity in namespace %s, deploying anyway: %v", c.namespace, err)
+			free = reserved + 1
+		}
+
+		if free-reserved <= 0 {
+			c.logger.Debugf("no Orka capacity for VM config %s in namespace %s, %d runners in queue", head.vmConfig, c.namespace, c.QueueDepth())
+			return
+		}
+
+		c.mu.Lock()
+		if len(c.queue) == 0 || c.queue[0] != head {
+			c.mu.Unlock()
+			continue
+		}
+		c.queue = c.queue[1:]
+		c.reserved++
+		depth := c.updateQueueDepth()
+		close(head.granted)
+		c.mu.Unlock()
+
+		c.logger.Debugf("granted Orka capacity for VM config %s, %d runners left in queue", head.vmConfig, depth)
+	}
+}
+
+// freeSlots returns how many VMs with the given config fit on the ready nodes of the namespace. A node fits as many
+// VMs as both its free CPU and its free memory allow.
+func (c *CapacityManager) freeSlots(ctx context.Context, vmConfig string) (int, error) {
+	config, err := c.vmConfig(ctx, vmConfig)
+	if err != nil {
+		return 0, err
+	}
+
+	nodes, err := c.orkaClient.ListNodes(ctx, c.namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	slots := 0
+	for _, node := range nodes {
+		if node.Phase != "" && !strings.EqualFold(node.Phase, orka.NodeReady) {
+			continue
+		}
+
+		nodeSlots := node.AvailableCPU / config.CPU
+		if memory, ok := parseMemory(node.AvailableMemory); ok {
+			if config.Memory > 0 {
+				nodeSlots = min(nodeSlots, int(memory/config.Memory))
+			} else if memory <= 0 {
+				nodeSlots = 0
+			}
+		}
+		slots += nodeSlots
+	}
+
+	return slots, nil
+}
+
+func (c *CapacityManager) vmConfig(ctx context.Context, vmConfig string) (*orka.OrkaVMConfigResponseModel, error) {
+	c.mu.Lock()
+	config, ok := c.vmConfigs[vmConfig]
+	c.mu.Unlock()
+	if ok {
+		return config, nil
+	}
+
+	config, err := c.orkaClient.GetVMConfig(ctx, vmConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil || config.CPU <= 0 {
+		return nil, fmt.Errorf("VM config %s does not specify a CPU count", vmConfig)
+	}
+
+	c.mu.Lock()
+	c.vmConfigs[vmConfig] = config
+	c.mu.Unlock()
+
+	return config, nil
+}
+
+func (c *CapacityManager) remove(request *capacityRequest) bool {
+	for i, r := range c.queue {
+		if r == request {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			c.updateQueueDepth()
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *CapacityManager) updateQueueDepth() int {
+	depth := len(c.queue)
+	metrics.ProvisioningQueueDepth.WithLabelValues(c.namespace).Set(float64(depth))
+
+	return depth
+}
+
+// memoryUnits are the factors that convert node memory units to gigabytes.
+var memoryUnits = map[string]float64{
+	"":   1.0 / (1 << 30),
+	"K":  1e3 / 1e9,
+	"M":  1e6 / 1e9,
+	"G":  1,
+	"T":  1e3,
+	"KI": 1.0 / (1 << 20),
+	"MI": 1.0 / (1 << 10),
+	"GI": 1,
+	"TI": 1 << 10,
+}
+
+// parseMemory converts a node memory value such as "12.5G" or "16Gi" to gigabytes. A value without a unit is in bytes.
+// It returns false for values that cannot be parsed, so that the CPU check alone decides.
+func parseMemory(memory string) (float64, bool) {
+	memory = strings.TrimSpace(memory)
+	number := strings.TrimRight(memory, "KMGTiBb")
+	if number == "" {
+		return 0, false
+	}
+
+	parsed, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	unit := strings.ToUpper(strings.TrimSuffix(strings.TrimSuffix(memory[len(number):], "B"), "b"))
+	factor, ok := memoryUnits[unit]
+	if !ok {
+		return 0, false
+	}
+
+	return parsed * factor, true
+}
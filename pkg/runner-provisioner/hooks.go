@@ -0,0 +1,85 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
+	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+	"github.com/macstadium/orka-github-actions-integration/pkg/tracing"
+)
+
+const (
+	hooksDir         = "/tmp/orka-github-runner-hooks"
+	hookHeredocToken = "ORKA_GITHUB_RUNNER_HOOK_EOF"
+)
+
+// runPreJobHooks runs the pre-job hooks of the runner on the VM. A failing hook fails the provisioning of the runner.
+func (p *RunnerProvisioner) runPreJobHooks(ctx context.Context, executor *orka.VMCommandExecutor, job *types.JobMessageBase) (err error) {
+	if len(p.runner.PreJobHookTemplates) == 0 {
+		return nil
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "RunPreJobHooks")
+	defer func() { tracing.End(span, err) }()
+
+	commands, err := hookCommands("pre-job", p.runner.PreJobHookTemplates, p.templateData(executor.VMName, executor.VMNode, job), false)
+	if err != nil {
+		p.countFailure(ctx, metrics.FailureReasonPreJobHook)
+		return err
+	}
+
+	p.logger.Infof("running %d pre-job hooks on VM %s", len(p.runner.PreJobHookTemplates), executor.VMName)
+	if err := executor.ExecuteCommands(ctx, append([]string{"set -e"}, commands...)...); err != nil {
+		p.logger.Errorf("pre-job hooks failed on VM %s: %v", executor.VMName, err)
+		if errors.Is(err, orka.ErrSSHConnect) || errors.Is(err, orka.ErrHostKeyMismatch) {
+			p.countFailure(ctx, metrics.FailureReasonSSHConnect)
+		} else {
+			p.countFailure(ctx, metrics.FailureReasonPreJobHook)
+		}
+		return fmt.Errorf("pre-job hooks failed on VM %s: %w", executor.VMName, err)
+	}
+
+	return nil
+}
+
+// hookCommands renders the hooks and returns the commands that write each of them to a file on the VM and run it. The
+// hooks read from /dev/null, so that they cannot consume the commands that follow them. When continueOnFailure is
+// false, a failing hook stops the commands that follow, provided they run with `set -e`.
+func hookCommands(kind string, hooks []*template.Template, data *TemplateData, continueOnFailure bool) ([]string, error) {
+	if len(hooks) == 0 {
+		return nil, nil
+	}
+
+	commands := []string{fmt.Sprintf("mkdir -p %s", hooksDir)}
+	for i, hook := range hooks {
+		var script strings.Builder
+		if err := hook.Execute(&script, data); err != nil {
+			return nil, fmt.Errorf("unable to render %s hook %s: %w", kind, hook.Name(), err)
+		}
+
+		content := script.String()
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+
+		path := fmt.Sprintf("%s/%s-%d", hooksDir, kind, i+1)
+		run := fmt.Sprintf("%s < /dev/null", path)
+		if continueOnFailure {
+			run += fmt.Sprintf(" || echo \"%s hook %s exited with code $?\"", kind, hook.Name())
+		}
+
+		commands = append(commands,
+			fmt.Sprintf("cat > %s <<'%s'\n%s%s", path, hookHeredocToken, content, hookHeredocToken),
+			fmt.Sprintf("chmod +x %s", path),
+			fmt.Sprintf("echo 'Running %s hook %s'", kind, hook.Name()),
+			run,
+		)
+	}
+
+	return commands, nil
+}
@@ -2,6 +2,7 @@ package provisioner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -12,48 +13,57 @@ import (
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/actions"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
 	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
 	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
-	"github.com/macstadium/orka-github-actions-integration/pkg/utils"
+	"github.com/macstadium/orka-github-actions-integration/pkg/state"
+	"github.com/macstadium/orka-github-actions-integration/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
 )
 
 type RunnerProvisioner struct {
 	runnerScaleSet *types.RunnerScaleSet
+	runner         *env.Runner
 	actionsClient  actions.ActionsService
 	envData        *env.Data
 
 	orkaClient orka.OrkaService
 	logger     *zap.SugaredLogger
 
+	warmPool *WarmPool
+	capacity *CapacityManager
+	limiter  *RunnerLimiter
+
+	stateStore state.Store
+
 	mu sync.Mutex
 }
 
-var commands_template = []string{
-	"set -e",
-	"echo \"Downloading Git Action Runner from https://github.com/actions/runner/releases/download/v$VERSION/actions-runner-osx-$(uname -m | sed 's/86_//')-$VERSION.tar.gz\"",
-	"mkdir -p /Users/$USERNAME/actions-runner",
-	"curl -o /Users/$USERNAME/actions-runner/actions-runner.tar.gz -L https://github.com/actions/runner/releases/download/v$VERSION/actions-runner-osx-$(uname -m | sed 's/86_//')-$VERSION.tar.gz",
-	"echo 'Git Action Runner download completed'",
-	"echo 'Unarchiving Git Action Runner /Users/$USERNAME/actions-runner/actions-runner.tar.gz'",
-	"cd /Users/$USERNAME/actions-runner",
-	"tar xzf /Users/$USERNAME/actions-runner/actions-runner.tar.gz",
-	"echo 'Git Action Runner unarchive completed'",
-	"echo 'Starting Git Action Runner'",
-	"/Users/$USERNAME/actions-runner/run.sh --jitconfig $JITCONFIG",
-	"echo 'Git Action Runner exited'",
-}
+// ProvisionRunner prepares a VM and a runner for the job. The job is nil for idle runners.
+func (p *RunnerProvisioner) ProvisionRunner(ctx context.Context, job *types.JobMessageBase) (*orka.VMCommandExecutor, []string, error) {
+	jobId, runnerRequestId := "", int64(0)
+	if job != nil {
+		jobId, runnerRequestId = job.JobId, job.RunnerRequestId
+	}
+
+	vmConfig := p.vmConfigFor(job)
+
+	// The warm pool only holds VMs of the default VM config
+	if p.warmPool != nil && vmConfig == p.runner.OrkaVMConfig {
+		if vm := p.warmPool.Take(); vm != nil {
+			return p.provisionWarmRunner(ctx, vm, job)
+		}
+		p.logger.Infof("warm pool is empty, deploying a new VM")
+	}
 
-func (p *RunnerProvisioner) ProvisionRunner(ctx context.Context) (*orka.VMCommandExecutor, []string, error) {
-	p.logger.Infof("deploying Orka VM with prefix %s", p.runnerScaleSet.Name)
-	vmResponse, err := p.orkaClient.DeployVM(ctx, p.runnerScaleSet.Name, p.envData.OrkaVMConfig)
+	vmCommandExecutor, err := p.deployVM(ctx, vmConfig, jobId, runnerRequestId)
 	if err != nil {
-		p.logger.Errorf("failed to deploy Orka VM: %v", err)
 		return nil, nil, err
 	}
 
-	runnerName := vmResponse.Name
-	p.logger.Infof("deployed Orka VM with name %s", runnerName)
-
+	runnerName := vmCommandExecutor.VMName
 	provisioningSucceeded := false
 
 	defer func() {
@@ -63,9 +73,7 @@ func (p *RunnerProvisioner) ProvisionRunner(ctx context.Context) (*orka.VMComman
 		}
 	}()
 
-	vmIP, err := p.getRealVMIP(vmResponse.IP)
-	if err != nil {
-		p.logger.Errorf("failed to get real VM IP for %s: %v", runnerName, err)
+	if err := p.runPreJobHooks(ctx, vmCommandExecutor, job); err != nil {
 		return nil, nil, err
 	}
 
@@ -73,26 +81,256 @@ func (p *RunnerProvisioner) ProvisionRunner(ctx context.Context) (*orka.VMComman
 	jitConfig, err := p.createRunner(ctx, runnerName)
 	if err != nil {
 		p.logger.Errorf("failed to create runner config for %s: %v", runnerName, err)
+		p.countFailure(ctx, metrics.FailureReasonJITConfig)
 		return nil, nil, err
 	}
 	p.logger.Infof("created runner config with name %s", runnerName)
 
-	vmCommandExecutor := &orka.VMCommandExecutor{
-		VMIP:       vmIP,
-		VMPort:     *vmResponse.SSH,
-		VMName:     runnerName,
-		VMUsername: p.envData.OrkaVMUsername,
-		VMPassword: p.envData.OrkaVMPassword,
-		Logger:     p.logger,
+	commands, err := p.runnerCommands(vmCommandExecutor, jitConfig.EncodedJITConfig, job, false)
+	if err != nil {
+		p.logger.Errorf("failed to build the commands for %s: %v", runnerName, err)
+		return nil, nil, err
 	}
 
-	commands := buildCommands(jitConfig.EncodedJITConfig, p.envData.GitHubRunnerVersion, p.envData.OrkaVMUsername)
+	p.markRunning(runnerName, jitConfig, jobId, runnerRequestId)
 
 	provisioningSucceeded = true
 
 	return vmCommandExecutor, commands, nil
 }
 
+// vmConfigFor returns the VM config for the job. The labelVMConfigs rule whose labels are all requested by the job
+// wins, and the rule with the most labels wins among several. Jobs that match no rule and idle runners use the
+// default VM config of the runner.
+func (p *RunnerProvisioner) vmConfigFor(job *types.JobMessageBase) string {
+	if job == nil {
+		return p.runner.OrkaVMConfig
+	}
+
+	requested := map[string]bool{}
+	for _, label := range job.RequestLabels {
+		requested[strings.ToLower(label)] = true
+	}
+
+	vmConfig, matched := p.runner.OrkaVMConfig, 0
+	for _, rule := range p.runner.LabelVMConfigs {
+		if len(rule.Labels) <= matched {
+			continue
+		}
+
+		matchesAll := true
+		for _, label := range rule.Labels {
+			if !requested[strings.ToLower(label)] {
+				matchesAll = false
+				break
+			}
+		}
+
+		if matchesAll {
+			vmConfig, matched = rule.VMConfig, len(rule.Labels)
+		}
+	}
+
+	return vmConfig
+}
+
+// deployVM deploys a new Orka VM with the VM config for the job and returns an executor for it. The VM is deleted if it
+// is not reachable.
+func (p *RunnerProvisioner) deployVM(ctx context.Context, vmConfig, jobId string, runnerRequestId int64) (*orka.VMCommandExecutor, error) {
+	if p.capacity != nil {
+		if err := p.capacity.Acquire(ctx, vmConfig); err != nil {
+			return nil, err
+		}
+		defer p.capacity.Release()
+	}
+
+	p.logger.Infof("deploying Orka VM with prefix %s and config %s in namespace %s", p.runnerScaleSet.Name, vmConfig, p.runner.OrkaNamespace)
+	deployStart := time.Now()
+	deployCtx, deploySpan := tracing.Tracer().Start(ctx, "DeployVM", trace.WithAttributes(
+		attribute.String("orka.namespace", p.runner.OrkaNamespace),
+		attribute.String("orka.vm_config", vmConfig),
+	))
+	vmResponse, err := p.orkaClient.DeployVM(deployCtx, &orka.DeployVMOptions{
+		Namespace:  p.runner.OrkaNamespace,
+		NamePrefix: p.runnerScaleSet.Name,
+		VMConfig:   vmConfig,
+		Metadata:   p.runner.OrkaVMMetadata,
+		Ownership: orka.VMOwnership{
+			ControllerId:    p.envData.ControllerId,
+			ScaleSetId:      p.runnerScaleSet.Id,
+			ScaleSetName:    p.runnerScaleSet.Name,
+			RunnerGroupId:   p.runnerScaleSet.RunnerGroupId,
+			JobId:           jobId,
+			RunnerRequestId: runnerRequestId,
+		},
+	})
+	if err != nil {
+		tracing.End(deploySpan, err)
+		p.logger.Errorf("failed to deploy Orka VM: %v", err)
+		p.countFailure(ctx, metrics.FailureReasonDeployVM)
+		return nil, err
+	}
+	deploySpan.SetAttributes(tracing.RunnerNameKey.String(vmResponse.Name))
+	deploySpan.End()
+
+	metrics.VMDeployDuration.WithLabelValues(p.runner.OrkaNamespace, vmConfig).Observe(time.Since(deployStart).Seconds())
+	p.logger.Infof("deployed Orka VM with name %s", vmResponse.Name)
+
+	now := time.Now()
+	p.saveState(&state.Record{
+		RunnerName:   vmResponse.Name,
+		ScaleSetId:   p.runnerScaleSet.Id,
+		ScaleSetName: p.runnerScaleSet.Name,
+		Namespace:    p.runner.OrkaNamespace,
+		IP:           vmResponse.IP,
+		Phase:        state.PhaseProvisioning,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
+
+	vmIP, err := p.getRealVMIP(vmResponse.IP)
+	if err != nil {
+		p.logger.Errorf("failed to get real VM IP for %s: %v", vmResponse.Name, err)
+		p.countFailure(ctx, metrics.FailureReasonVMIP)
+		p.deleteVM(context.WithoutCancel(ctx), vmResponse.Name)
+		return nil, err
+	}
+
+	hostKeyCallback, err := p.hostKeyCallback(ctx, vmResponse.Name)
+	if err != nil {
+		p.logger.Errorf("failed to set up host key verification for %s: %v", vmResponse.Name, err)
+		p.countFailure(ctx, metrics.FailureReasonSSHConnect)
+		p.deleteVM(context.WithoutCancel(ctx), vmResponse.Name)
+		return nil, err
+	}
+
+	return &orka.VMCommandExecutor{
+		VMIP:            vmIP,
+		VMPort:          *vmResponse.SSH,
+		VMName:          vmResponse.Name,
+		VMNode:          vmResponse.Node,
+		VMUsername:      p.runner.OrkaVMUsername,
+		VMPassword:      p.runner.OrkaVMPassword,
+		VMSigner:        p.envData.OrkaVMSSHSigner,
+		HostKeyCallback: hostKeyCallback,
+		Logger:          p.logger,
+	}, nil
+}
+
+// hostKeyCallback returns the callback that verifies the SSH host key of the VM, or nil when verification is disabled.
+// The known_hosts file is read for every VM so that changes to it apply without a restart.
+func (p *RunnerProvisioner) hostKeyCallback(ctx context.Context, vmName string) (ssh.HostKeyCallback, error) {
+	if p.envData.OrkaVMHostKeyFromMetadata {
+		vm, err := p.orkaClient.GetVM(ctx, p.runner.OrkaNamespace, vmName)
+		if err != nil {
+			return nil, err
+		}
+
+		pinned := vm.Metadata[orka.HostKeyMetadataKey]
+		if pinned == "" {
+			return nil, fmt.Errorf("%w: VM %s has no %s metadata to verify its host key against", orka.ErrHostKeyMismatch, vmName, orka.HostKeyMetadataKey)
+		}
+
+		return orka.PinnedHostKeyCallback(pinned)
+	}
+
+	if p.envData.OrkaVMKnownHostsPath != "" {
+		return orka.KnownHostsCallback(p.envData.OrkaVMKnownHostsPath)
+	}
+
+	return nil, nil
+}
+
+// IsManagedVM reports whether the VM is recorded as in use by this process.
+func (p *RunnerProvisioner) IsManagedVM(vmName string) bool {
+	if p.stateStore == nil {
+		return false
+	}
+
+	record, err := p.stateStore.Get(vmName)
+
+	return err != nil || record != nil
+}
+
+func (p *RunnerProvisioner) provisionWarmRunner(ctx context.Context, vm *warmVM, job *types.JobMessageBase) (*orka.VMCommandExecutor, []string, error) {
+	jobId, runnerRequestId := "", int64(0)
+	if job != nil {
+		jobId, runnerRequestId = job.JobId, job.RunnerRequestId
+	}
+
+	runnerName := vm.executor.VMName
+	p.logger.Infof("using warm pool VM %s", runnerName)
+
+	if err := p.runPreJobHooks(ctx, vm.executor, job); err != nil {
+		p.cleanupResources(context.WithoutCancel(ctx), runnerName)
+		return nil, nil, err
+	}
+
+	p.logger.Infof("creating runner config for name %s", runnerName)
+	jitConfig, err := p.createRunner(ctx, runnerName)
+	if err != nil {
+		p.logger.Errorf("failed to create runner config for %s: %v", runnerName, err)
+		p.countFailure(ctx, metrics.FailureReasonJITConfig)
+		p.cleanupResources(context.WithoutCancel(ctx), runnerName)
+		return nil, nil, err
+	}
+	p.logger.Infof("created runner config with name %s", runnerName)
+
+	commands, err := p.runnerCommands(vm.executor, jitConfig.EncodedJITConfig, job, true)
+	if err != nil {
+		p.logger.Errorf("failed to build the commands for %s: %v", runnerName, err)
+		p.cleanupResources(context.WithoutCancel(ctx), runnerName)
+		return nil, nil, err
+	}
+
+	p.markRunning(runnerName, jitConfig, jobId, runnerRequestId)
+
+	return vm.executor, commands, nil
+}
+
+// StartWarmPool keeps the warm pool filled until the context is canceled. It is a no-op when no warm pool is configured.
+func (p *RunnerProvisioner) StartWarmPool(ctx context.Context) {
+	if p.warmPool == nil {
+		return
+	}
+
+	p.warmPool.Start(ctx)
+}
+
+// Close deletes the VMs that are still idle in the warm pool.
+func (p *RunnerProvisioner) Close(ctx context.Context) {
+	if p.warmPool == nil {
+		return
+	}
+
+	p.warmPool.Close(ctx)
+}
+
+// AcquireRunnerSlot blocks until the scale set and global runner limits allow another runner.
+func (p *RunnerProvisioner) AcquireRunnerSlot(ctx context.Context) error {
+	return p.limiter.Acquire(ctx)
+}
+
+// ReleaseRunnerSlot frees a slot taken by AcquireRunnerSlot once the runner's VM is gone.
+func (p *RunnerProvisioner) ReleaseRunnerSlot() {
+	p.limiter.Release()
+}
+
+// AvailableRunnerSlots returns how many more runners can be started without waiting.
+func (p *RunnerProvisioner) AvailableRunnerSlots() int {
+	return p.limiter.Available()
+}
+
+// PostJobHookTimeout returns how long the runner's SSH session may keep running its post-job hooks after the job
+// completed. It is zero when the runner has no post-job hooks.
+func (p *RunnerProvisioner) PostJobHookTimeout() time.Duration {
+	if len(p.runner.PostJobHookTemplates) == 0 {
+		return 0
+	}
+
+	return p.envData.PostJobHookTimeout
+}
+
 func (p *RunnerProvisioner) CleanupResources(ctx context.Context, runnerName string) {
 	p.logger.Infof("starting resource cleanup for %s", runnerName)
 	p.cleanupResources(ctx, runnerName)
@@ -114,6 +352,16 @@ func (p *RunnerProvisioner) getRealVMIP(vmIP string) (string, error) {
 func (p *RunnerProvisioner) cleanupResources(ctx context.Context, runnerName string) {
 	p.logger.Infof("starting resource cleanup for %s", runnerName)
 
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = tracing.JobContext(ctx, p.runnerRequestId(runnerName))
+	}
+	ctx, span := tracing.Tracer().Start(ctx, "CleanupResources", trace.WithAttributes(tracing.RunnerNameKey.String(runnerName)))
+	defer span.End()
+
+	p.updateState(runnerName, func(record *state.Record) {
+		record.Phase = state.PhaseCleanup
+	})
+
 	for {
 		err := p.ensureRunnerDeregistered(ctx, runnerName)
 		if err != nil {
@@ -135,12 +383,14 @@ func (p *RunnerProvisioner) cleanupResources(ctx context.Context, runnerName str
 func (p *RunnerProvisioner) deleteVM(ctx context.Context, runnerName string) {
 	p.logger.Infof("initiating deletion of Orka VM %s", runnerName)
 
+	ctx, span := tracing.Tracer().Start(ctx, "DeleteVM", trace.WithAttributes(tracing.RunnerNameKey.String(runnerName)))
+
 	attempts := 0
 	operation := func() error {
 		attempts++
-		err := p.orkaClient.DeleteVM(ctx, runnerName)
+		err := p.orkaClient.DeleteVM(ctx, p.runner.OrkaNamespace, runnerName)
 		if err != nil {
-			if strings.Contains(err.Error(), "not found") {
+			if errors.Is(err, orka.ErrVMNotFound) {
 				p.logger.Warnf("Orka VM %s not found (it may have already been deleted)", runnerName)
 				return nil
 			}
@@ -151,16 +401,26 @@ func (p *RunnerProvisioner) deleteVM(ctx context.Context, runnerName string) {
 	}
 
 	err := backoff.Retry(operation, backoff.NewExponentialBackOff())
+	span.SetAttributes(attribute.Int("orka.delete_attempts", attempts))
+	tracing.End(span, err)
 	if err != nil {
 		p.logger.Errorf("error while deleting Orka VM %s. More information: %s", runnerName, err.Error())
 	} else {
 		p.logger.Infof("successfully deleted Orka VM %s", runnerName)
+		p.deleteState(runnerName)
+	}
+
+	if p.capacity != nil {
+		p.capacity.Notify()
 	}
 }
 
-func (p *RunnerProvisioner) ensureRunnerDeregistered(ctx context.Context, runnerName string) error {
+func (p *RunnerProvisioner) ensureRunnerDeregistered(ctx context.Context, runnerName string) (err error) {
 	p.logger.Infof("waiting for runner %s to de-register from GitHub", runnerName)
 
+	ctx, span := tracing.Tracer().Start(ctx, "WaitForDeregistration", trace.WithAttributes(tracing.RunnerNameKey.String(runnerName)))
+	defer func() { tracing.End(span, err) }()
+
 	timeoutCtx, cancel := context.WithTimeout(ctx, p.envData.RunnerDeregistrationTimeout)
 	defer cancel()
 
@@ -216,6 +476,7 @@ func (p *RunnerProvisioner) forceDeleteRunner(ctx context.Context, runnerName st
 		return err
 	}
 
+	metrics.RunnersForceDeleted.WithLabelValues(p.runnerScaleSet.Name).Inc()
 	p.logger.Infof("successfully force-deleted runner %s (ID: %d) from GitHub", runnerName, runner.Id)
 	return nil
 }
@@ -230,7 +491,9 @@ func (p *RunnerProvisioner) createRunner(ctx context.Context, runnerName string)
 		p.logger.Debugf("released lock for runner %s", runnerName)
 	}()
 
+	ctx, span := tracing.Tracer().Start(ctx, "CreateRunner", trace.WithAttributes(tracing.RunnerNameKey.String(runnerName)))
 	jitConfig, err := p.actionsClient.CreateRunner(ctx, p.runnerScaleSet.Id, runnerName)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
@@ -238,26 +501,31 @@ func (p *RunnerProvisioner) createRunner(ctx context.Context, runnerName string)
 	return jitConfig, nil
 }
 
-func buildCommands(jitConfig, version, username string) []string {
-	commands := utils.Map(
-		commands_template,
-		func(cmd string) string {
-			result := strings.ReplaceAll(cmd, "$JITCONFIG", jitConfig)
-			result = strings.ReplaceAll(result, "$VERSION", version)
-			result = strings.ReplaceAll(result, "$USERNAME", username)
+// countFailure counts a failed provisioning step. Steps that failed because provisioning was canceled are not counted.
+func (p *RunnerProvisioner) countFailure(ctx context.Context, reason string) {
+	if ctx.Err() != nil {
+		return
+	}
 
-			return result
-		},
-	)
-	return commands
+	metrics.ProvisioningFailures.WithLabelValues(p.runnerScaleSet.Name, reason).Inc()
 }
 
-func NewRunnerProvisioner(runnerScaleSet *types.RunnerScaleSet, actionsClient actions.ActionsService, orkaClient orka.OrkaService, envData *env.Data) *RunnerProvisioner {
-	return &RunnerProvisioner{
+func NewRunnerProvisioner(runnerScaleSet *types.RunnerScaleSet, runner *env.Runner, actionsClient actions.ActionsService, orkaClient orka.OrkaService, capacity *CapacityManager, limiter *RunnerLimiter, stateStore state.Store, envData *env.Data) *RunnerProvisioner {
+	p := &RunnerProvisioner{
 		runnerScaleSet: runnerScaleSet,
+		runner:         runner,
 		actionsClient:  actionsClient,
 		envData:        envData,
 		orkaClient:     orkaClient,
+		capacity:       capacity,
+		limiter:        limiter,
+		stateStore:     stateStore,
 		logger:         logging.Logger.Named(fmt.Sprintf("runner-provisioner-%d", runnerScaleSet.Id)),
 	}
+
+	if runner.WarmPool != nil && runner.WarmPool.MaxSize > 0 {
+		p.warmPool = newWarmPool(p, runner.WarmPool)
+	}
+
+	return p
 }
@@ -2,16 +2,28 @@ package provisioner
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
 	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"text/template"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/macstadium/orka-github-actions-integration/pkg/env"
 	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
 	"github.com/macstadium/orka-github-actions-integration/pkg/logging"
+	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+	"github.com/macstadium/orka-github-actions-integration/pkg/state"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestProvisioner(t *testing.T) {
@@ -52,6 +64,10 @@ func (m *MockActionsService) CreateRunnerScaleSet(ctx context.Context, runnerSca
 	return nil, nil
 }
 
+func (m *MockActionsService) UpdateRunnerScaleSet(ctx context.Context, runnerScaleSetId int, runnerScaleSet *types.RunnerScaleSet) (*types.RunnerScaleSet, error) {
+	return nil, nil
+}
+
 func (m *MockActionsService) DeleteRunnerScaleSet(ctx context.Context, runnerScaleSetId int) error {
 	return nil
 }
@@ -88,6 +104,51 @@ func (m *MockActionsService) DeleteMessage(ctx context.Context, messageQueueUrl,
 	return nil
 }
 
+// MockOrkaService is a mock implementation of orka.OrkaService
+type MockOrkaService struct {
+	ListNodesFunc   func(ctx context.Context, namespace string) ([]*orka.OrkaNodeResponseModel, error)
+	GetVMConfigFunc func(ctx context.Context, name string) (*orka.OrkaVMConfigResponseModel, error)
+	GetVMFunc       func(ctx context.Context, namespace, name string) (*orka.OrkaVMResponseModel, error)
+	DeleteVMFunc    func(ctx context.Context, namespace, name string) error
+}
+
+func (m *MockOrkaService) ListNodes(ctx context.Context, namespace string) ([]*orka.OrkaNodeResponseModel, error) {
+	if m.ListNodesFunc != nil {
+		return m.ListNodesFunc(ctx, namespace)
+	}
+	return nil, nil
+}
+
+func (m *MockOrkaService) GetVMConfig(ctx context.Context, name string) (*orka.OrkaVMConfigResponseModel, error) {
+	if m.GetVMConfigFunc != nil {
+		return m.GetVMConfigFunc(ctx, name)
+	}
+	return nil, nil
+}
+
+// Stub implementations for other OrkaService methods
+func (m *MockOrkaService) DeployVM(ctx context.Context, options *orka.DeployVMOptions) (*orka.OrkaVMDeployResponseModel, error) {
+	return nil, nil
+}
+
+func (m *MockOrkaService) DeleteVM(ctx context.Context, namespace, name string) error {
+	if m.DeleteVMFunc != nil {
+		return m.DeleteVMFunc(ctx, namespace, name)
+	}
+	return nil
+}
+
+func (m *MockOrkaService) GetVM(ctx context.Context, namespace, name string) (*orka.OrkaVMResponseModel, error) {
+	if m.GetVMFunc != nil {
+		return m.GetVMFunc(ctx, namespace, name)
+	}
+	return nil, nil
+}
+
+func (m *MockOrkaService) ListVMs(ctx context.Context, namespace string) ([]*orka.OrkaVMResponseModel, error) {
+	return nil, nil
+}
+
 const testRunnerName = "test-runner-1"
 
 var _ = Describe("RunnerProvisioner", func() {
@@ -259,4 +320,465 @@ var _ = Describe("RunnerProvisioner", func() {
 			})
 		})
 	})
+
+	Describe("runnerCommands", func() {
+		var (
+			executor *orka.VMCommandExecutor
+			job      *types.JobMessageBase
+		)
+
+		BeforeEach(func() {
+			provisioner.envData.GitHubRunnerVersion = "2.320.0"
+			provisioner.envData.RunnerDownloadURL = "https://github.com/actions/runner/releases/download"
+			provisioner.runner = &env.Runner{OrkaVMUsername: "admin"}
+			executor = &orka.VMCommandExecutor{VMName: "runner-abc12", VMNode: "mini-1"}
+			job = &types.JobMessageBase{
+				JobId:          "job-1",
+				OwnerName:      "org",
+				RepositoryName: "repo",
+				JobWorkflowRef: "org/repo/.github/workflows/ci.yml@refs/heads/main",
+				RequestLabels:  []string{"self-hosted", "macos"},
+			}
+		})
+
+		It("should download and start the runner with the built-in bootstrap script", func() {
+			commands, err := provisioner.runnerCommands(executor, "jit", job, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(commands).To(HaveLen(3))
+			Expect(commands[0]).To(ContainSubstring("RUNNER_URL=https://github.com/actions/runner/releases/download/v2.320.0/actions-runner-osx-$RUNNER_ARCH-2.320.0.tar.gz"))
+			Expect(commands[0]).NotTo(ContainSubstring("shasum"))
+			Expect(commands[1]).To(ContainSubstring("/Users/admin/actions-runner/run.sh --jitconfig jit || RUNNER_EXIT_CODE=$?"))
+			Expect(commands[2]).To(Equal("exit ${RUNNER_EXIT_CODE:-0}"))
+		})
+
+		It("should download the runner from the cache and verify its checksum", func() {
+			provisioner.envData.EnableRunnerCache = true
+			provisioner.envData.RunnerCacheURL = "http://10.221.188.5:8082"
+			provisioner.envData.RunnerSHA256Checksums = map[string]string{"arm64": "abc", "x64": "def"}
+
+			commands, err := provisioner.runnerCommands(executor, "jit", job, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(commands[0]).To(ContainSubstring("RUNNER_URL=http://10.221.188.5:8082/v2.320.0/"))
+			Expect(commands[0]).To(ContainSubstring("arm64) RUNNER_SHA256=abc ;;\nx64) RUNNER_SHA256=def ;;"))
+			Expect(commands[0]).To(ContainSubstring("shasum -a 256 -c -"))
+		})
+
+		It("should only start the runner on prepared VMs", func() {
+			commands, err := provisioner.runnerCommands(executor, "jit", job, true)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(commands).To(HaveLen(2))
+			Expect(commands[0]).NotTo(ContainSubstring("curl"))
+		})
+
+		It("should run a custom bootstrap template as a whole", func() {
+			provisioner.runner.BootstrapTemplate = template.Must(template.New("bootstrap.sh").Parse(
+				"/opt/runner/run.sh --jitconfig {{.JITConfig}} # {{.VMName}} {{.Node}} {{.JobId}} {{.Repository}} {{.WorkflowRef}} {{range .Labels}}{{.}},{{end}}",
+			))
+
+			commands, err := provisioner.runnerCommands(executor, "jit", job, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(commands).To(Equal([]string{
+				"/opt/runner/run.sh --jitconfig jit # runner-abc12 mini-1 job-1 org/repo org/repo/.github/workflows/ci.yml@refs/heads/main self-hosted,macos,",
+				"exit ${RUNNER_EXIT_CODE:-0}",
+			}))
+		})
+
+		It("should run the templated post-job hooks after the runner", func() {
+			provisioner.runner.PostJobHookTemplates = []*template.Template{
+				template.Must(template.New("upload.sh").Parse("#!/bin/bash\necho {{.VMName}} {{.JobId}} {{.RunnerVersion}} {{.JITConfig}}")),
+			}
+
+			commands, err := provisioner.runnerCommands(executor, "jit", job, true)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(commands[0]).To(ContainSubstring("run.sh"))
+			Expect(commands).To(ContainElement(ContainSubstring("#!/bin/bash\necho runner-abc12 job-1 2.320.0 \n")))
+			Expect(commands).To(ContainElement(HavePrefix("/tmp/orka-github-runner-hooks/post-job-1 < /dev/null ||")))
+			Expect(commands[len(commands)-1]).To(Equal("exit ${RUNNER_EXIT_CODE:-0}"))
+		})
+
+		It("should fail when a template uses an unknown field", func() {
+			provisioner.runner.PostJobHookTemplates = []*template.Template{
+				template.Must(template.New("broken.sh").Parse("echo {{.Unknown}}")),
+			}
+
+			_, err := provisioner.runnerCommands(executor, "jit", job, true)
+			Expect(err).To(MatchError(ContainSubstring("broken.sh")))
+		})
+	})
+
+	Describe("vmConfigFor", func() {
+		BeforeEach(func() {
+			provisioner.runner = &env.Runner{
+				OrkaVMConfig: "sonoma",
+				LabelVMConfigs: []env.LabelVMConfig{
+					{Labels: []string{"xcode-16"}, VMConfig: "sonoma-xcode16"},
+					{Labels: []string{"xcode-16", "arm64-large"}, VMConfig: "sonoma-xcode16-large"},
+					{Labels: []string{"arm64-large"}, VMConfig: "large-config"},
+					{Labels: []string{"xcode-16"}, VMConfig: "unused"},
+				},
+			}
+		})
+
+		DescribeTable("should pick the VM config that best matches the requested labels",
+			func(labels []string, expected string) {
+				Expect(provisioner.vmConfigFor(&types.JobMessageBase{RequestLabels: labels})).To(Equal(expected))
+			},
+			Entry("no matching rule", []string{"test-runner"}, "sonoma"),
+			Entry("single label", []string{"test-runner", "XCode-16"}, "sonoma-xcode16"),
+			Entry("most specific rule", []string{"arm64-large", "test-runner", "xcode-16"}, "sonoma-xcode16-large"),
+			Entry("other single label", []string{"arm64-large"}, "large-config"),
+		)
+
+		It("should use the default VM config for idle runners", func() {
+			Expect(provisioner.vmConfigFor(nil)).To(Equal("sonoma"))
+		})
+	})
+
+	Describe("WarmPool", func() {
+		var pool *WarmPool
+
+		BeforeEach(func() {
+			pool = newWarmPool(provisioner, &env.WarmPool{MinSize: 1, MaxSize: 2, MaxIdleAgeDuration: time.Hour})
+		})
+
+		It("should hand out the VM that has been ready the longest", func() {
+			older := &warmVM{executor: &orka.VMCommandExecutor{VMName: "vm-1"}, readyAt: time.Now().Add(-time.Minute)}
+			newer := &warmVM{executor: &orka.VMCommandExecutor{VMName: "vm-2"}, readyAt: time.Now()}
+			pool.ready = []*warmVM{older, newer}
+
+			Expect(pool.Take()).To(Equal(older))
+			Expect(pool.ready).To(ConsistOf(newer))
+		})
+
+		It("should grow the target size up to the maximum when empty", func() {
+			Expect(pool.Take()).To(BeNil())
+			Expect(pool.target).To(Equal(2))
+
+			Expect(pool.Take()).To(BeNil())
+			Expect(pool.target).To(Equal(2))
+		})
+
+		It("should wait for Start to return before closing", func() {
+			pool = newWarmPool(provisioner, &env.WarmPool{MaxIdleAgeDuration: time.Hour})
+			runCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			started := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				pool.Start(runCtx)
+				close(started)
+			}()
+			Eventually(func() chan struct{} {
+				pool.mu.Lock()
+				defer pool.mu.Unlock()
+				return pool.stopped
+			}).ShouldNot(BeNil())
+
+			closed := make(chan struct{})
+			go func() {
+				pool.Close(ctx)
+				close(closed)
+			}()
+
+			Consistently(closed).WithTimeout(100 * time.Millisecond).ShouldNot(BeClosed())
+
+			cancel()
+			Eventually(closed).Should(BeClosed())
+			Eventually(started).Should(BeClosed())
+		})
+
+		It("should not start once closed", func() {
+			pool.Close(ctx)
+			pool.Start(ctx)
+
+			Expect(pool.warming).To(BeZero())
+		})
+	})
+
+	Describe("CapacityManager", func() {
+		var (
+			capacity      *CapacityManager
+			mockOrka      *MockOrkaService
+			availableCPU  int
+			capacityError error
+		)
+
+		BeforeEach(func() {
+			availableCPU = 8
+			capacityError = nil
+			mockOrka = &MockOrkaService{
+				GetVMConfigFunc: func(ctx context.Context, name string) (*orka.OrkaVMConfigResponseModel, error) {
+					return &orka.OrkaVMConfigResponseModel{Name: name, CPU: 4}, nil
+				},
+				ListNodesFunc: func(ctx context.Context, namespace string) ([]*orka.OrkaNodeResponseModel, error) {
+					return []*orka.OrkaNodeResponseModel{
+						{Name: "node-1", AvailableCPU: availableCPU, AvailableMemory: "32G", Phase: orka.NodeReady},
+						{Name: "node-2", AvailableCPU: 12, AvailableMemory: "0G", Phase: orka.NodeReady},
+						{Name: "node-3", AvailableCPU: 12, AvailableMemory: "32G", Phase: "NOT_READY"},
+					}, capacityError
+				},
+			}
+			capacity = NewCapacityManager(mockOrka, "orka-default", time.Hour)
+		})
+
+		It("should only count ready nodes with free memory", func() {
+			Expect(capacity.freeSlots(ctx, "sonoma")).To(Equal(2))
+		})
+
+		It("should only count nodes with enough free memory for the VM config", func() {
+			mockOrka.GetVMConfigFunc = func(ctx context.Context, name string) (*orka.OrkaVMConfigResponseModel, error) {
+				return &orka.OrkaVMConfigResponseModel{Name: name, CPU: 4, Memory: 12}, nil
+			}
+			mockOrka.ListNodesFunc = func(ctx context.Context, namespace string) ([]*orka.OrkaNodeResponseModel, error) {
+				return []*orka.OrkaNodeResponseModel{
+					{Name: "node-1", AvailableCPU: 12, AvailableMemory: "8G", Phase: orka.NodeReady},
+					{Name: "node-2", AvailableCPU: 12, AvailableMemory: "30Gi", Phase: orka.NodeReady},
+					{Name: "node-3", AvailableCPU: 4, AvailableMemory: "64G", Phase: orka.NodeReady},
+				}, nil
+			}
+
+			Expect(capacity.freeSlots(ctx, "sonoma")).To(Equal(3))
+		})
+
+		DescribeTable("when parsing node memory",
+			func(memory string, expected float64, ok bool) {
+				parsed, parsedOk := parseMemory(memory)
+				Expect(parsedOk).To(Equal(ok))
+				Expect(parsed).To(BeNumerically("~", expected, 0.001))
+			},
+			Entry("with gigabytes", "12.5G", 12.5, true),
+			Entry("with gibibytes", "16Gi", 16.0, true),
+			Entry("with megabytes", "512MB", 0.512, true),
+			Entry("with bytes", "1073741824", 1.0, true),
+			Entry("with an unknown unit", "12X", 0.0, false),
+			Entry("with an empty value", "", 0.0, false),
+		)
+
+		It("should grant requests while capacity is free", func() {
+			runCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			go capacity.Start(runCtx)
+
+			Expect(capacity.Acquire(runCtx, "sonoma")).To(Succeed())
+			Expect(capacity.Acquire(runCtx, "sonoma")).To(Succeed())
+
+			timeoutCtx, cancelTimeout := context.WithTimeout(runCtx, 100*time.Millisecond)
+			defer cancelTimeout()
+			Expect(capacity.Acquire(timeoutCtx, "sonoma")).To(MatchError(context.DeadlineExceeded))
+			Expect(capacity.QueueDepth()).To(Equal(0))
+		})
+
+		It("should queue requests until capacity is released", func() {
+			availableCPU = 4
+			capacity.queue = []*capacityRequest{{vmConfig: "sonoma", granted: make(chan struct{})}}
+			capacity.dispatch(ctx)
+			Expect(capacity.QueueDepth()).To(Equal(0))
+			Expect(capacity.reserved).To(Equal(1))
+
+			waiting := &capacityRequest{vmConfig: "sonoma", granted: make(chan struct{})}
+			capacity.queue = []*capacityRequest{waiting}
+			capacity.dispatch(ctx)
+			Expect(capacity.QueueDepth()).To(Equal(1))
+
+			capacity.Release()
+			capacity.dispatch(ctx)
+			Expect(capacity.QueueDepth()).To(Equal(0))
+			Eventually(waiting.granted).Should(BeClosed())
+		})
+
+		It("should not block deployments when capacity cannot be checked", func() {
+			capacityError = errors.New("orka unavailable")
+			request := &capacityRequest{vmConfig: "sonoma", granted: make(chan struct{})}
+			capacity.queue = []*capacityRequest{request}
+			capacity.dispatch(ctx)
+			Expect(request.granted).To(BeClosed())
+		})
+	})
+
+	Describe("RunnerLimiter", func() {
+		It("should not limit when no maximum is set", func() {
+			limiter := NewRunnerLimiter(0, nil)
+			Expect(limiter.Acquire(ctx)).To(Succeed())
+			Expect(limiter.Available()).To(Equal(math.MaxInt))
+		})
+
+		It("should wait for a slot of the scale set and the global limit", func() {
+			global := NewRunnerLimiter(2, nil)
+			scaleSet := NewRunnerLimiter(5, global)
+
+			Expect(scaleSet.Acquire(ctx)).To(Succeed())
+			Expect(scaleSet.Acquire(ctx)).To(Succeed())
+			Expect(scaleSet.Available()).To(Equal(0))
+
+			timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			Expect(scaleSet.Acquire(timeoutCtx)).To(MatchError(context.DeadlineExceeded))
+
+			acquired := make(chan error)
+			go func() { acquired <- scaleSet.Acquire(ctx) }()
+			Consistently(acquired, 50*time.Millisecond).ShouldNot(Receive())
+
+			scaleSet.Release()
+			Eventually(acquired).Should(Receive(BeNil()))
+			Expect(global.Available()).To(Equal(0))
+		})
+	})
+
+	Describe("RecoverRunners", func() {
+		agent := func(payload string) *types.RunnerReference {
+			var runners types.RunnerReferenceList
+			Expect(json.Unmarshal([]byte(`{"count":1,"value":[`+payload+`]}`), &runners)).To(Succeed())
+			return &runners.RunnerReferences[0]
+		}
+
+		DescribeTable("when deciding from the agent of the runner",
+			func(payload string, adopted bool) {
+				store := state.NewMemoryStore()
+				Expect(store.Put(&state.Record{RunnerName: "test-runner-vm", ScaleSetName: "test-runner", Phase: state.PhaseRunning})).To(Succeed())
+
+				provisioner.stateStore = store
+				provisioner.runner = &env.Runner{OrkaNamespace: "orka-default"}
+				provisioner.orkaClient = &MockOrkaService{
+					GetVMFunc: func(ctx context.Context, namespace, name string) (*orka.OrkaVMResponseModel, error) {
+						return &orka.OrkaVMResponseModel{Name: name}, nil
+					},
+					DeleteVMFunc: func(ctx context.Context, namespace, name string) error {
+						return nil
+					},
+				}
+				mockActions.GetRunnerFunc = func(ctx context.Context, runnerName string) (*types.RunnerReference, error) {
+					return agent(payload), nil
+				}
+
+				if adopted {
+					Expect(provisioner.RecoverRunners(ctx)).To(ConsistOf("test-runner-vm"))
+				} else {
+					Expect(provisioner.RecoverRunners(ctx)).To(BeEmpty())
+				}
+			},
+			Entry("should adopt an online busy runner", `{"id":12,"name":"test-runner-vm","version":"2.320.0","enabled":true,"status":"online","busy":true,"runnerScaleSetId":1}`, true),
+			Entry("should adopt a runner without busy state and status", `{"id":12,"name":"test-runner-vm","runnerScaleSetId":1}`, true),
+			Entry("should adopt an online runner without busy state", `{"id":12,"name":"test-runner-vm","status":"online","runnerScaleSetId":1}`, true),
+			Entry("should delete an idle runner", `{"id":12,"name":"test-runner-vm","status":"online","busy":false,"runnerScaleSetId":1}`, false),
+			Entry("should delete an offline runner", `{"id":12,"name":"test-runner-vm","status":"offline","runnerScaleSetId":1}`, false),
+		)
+
+		It("should adopt busy runners and forget VMs that no longer exist", func() {
+			store := state.NewMemoryStore()
+			Expect(store.Put(&state.Record{RunnerName: "test-runner-busy", ScaleSetName: "test-runner", Phase: state.PhaseRunning})).To(Succeed())
+			Expect(store.Put(&state.Record{RunnerName: "test-runner-gone", ScaleSetName: "test-runner", Phase: state.PhaseRunning})).To(Succeed())
+			Expect(store.Put(&state.Record{RunnerName: "other-runner-busy", ScaleSetName: "other-runner", Phase: state.PhaseRunning})).To(Succeed())
+
+			provisioner.stateStore = store
+			provisioner.orkaClient = &MockOrkaService{
+				GetVMFunc: func(ctx context.Context, namespace, name string) (*orka.OrkaVMResponseModel, error) {
+					if name == "test-runner-gone" {
+						return nil, orka.ErrVMNotFound
+					}
+					return &orka.OrkaVMResponseModel{Name: name}, nil
+				},
+			}
+			mockActions.GetRunnerFunc = func(ctx context.Context, runnerName string) (*types.RunnerReference, error) {
+				if runnerName == "test-runner-busy" {
+					return agent(`{"id":1,"name":"test-runner-busy","status":"online","busy":true}`), nil
+				}
+				return nil, nil
+			}
+
+			Expect(provisioner.RecoverRunners(ctx)).To(ConsistOf("test-runner-busy"))
+			Expect(store.Get("test-runner-gone")).To(BeNil())
+			Expect(store.Get("other-runner-busy")).NotTo(BeNil())
+		})
+
+		It("should delete the VMs of busy runners whose process is gone", func() {
+			store := state.NewMemoryStore()
+			Expect(store.Put(&state.Record{RunnerName: "test-runner-offline", ScaleSetName: "test-runner", Phase: state.PhaseRunning})).To(Succeed())
+
+			deleted := make(chan string, 1)
+			provisioner.stateStore = store
+			provisioner.runner = &env.Runner{OrkaNamespace: "orka-default"}
+			provisioner.orkaClient = &MockOrkaService{
+				GetVMFunc: func(ctx context.Context, namespace, name string) (*orka.OrkaVMResponseModel, error) {
+					return &orka.OrkaVMResponseModel{Name: name}, nil
+				},
+				DeleteVMFunc: func(ctx context.Context, namespace, name string) error {
+					deleted <- name
+					return nil
+				},
+			}
+			mockActions.GetRunnerFunc = func(ctx context.Context, runnerName string) (*types.RunnerReference, error) {
+				return agent(`{"id":1,"name":"test-runner-offline","status":"offline","busy":true}`), nil
+			}
+			mockActions.DeleteRunnerFunc = func(ctx context.Context, runnerID int) error {
+				return errors.New("runner is currently running a job and cannot be deleted")
+			}
+
+			Expect(provisioner.RecoverRunners(ctx)).To(BeEmpty())
+			Eventually(deleted).Should(Receive(Equal("test-runner-offline")))
+			Eventually(func() (*state.Record, error) { return store.Get("test-runner-offline") }).Should(BeNil())
+		})
+	})
+	Describe("host key verification from metadata", func() {
+		setenv := func(name, value string) {
+			DeferCleanup(os.Unsetenv, name)
+			Expect(os.Setenv(name, value)).To(Succeed())
+		}
+
+		It("should verify the host key pinned in the VM metadata from the env to the SSH callback", func() {
+			hostKey, _, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			publicKey, err := ssh.NewPublicKey(hostKey)
+			Expect(err).NotTo(HaveOccurred())
+			otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			otherPublicKey, err := ssh.NewPublicKey(otherKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			sshPort := 8822
+			var deployed map[string]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/orka-default/vms":
+					var body orka.OrkaVMDeployRequestModel
+					Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+					deployed = body.Metadata
+					Expect(json.NewEncoder(w).Encode(orka.OrkaVMDeployResponseModel{Name: "runner-abc12", IP: "10.0.0.1", SSH: &sshPort})).To(Succeed())
+				case r.Method == http.MethodGet && r.URL.Path == "/api/v1/namespaces/orka-default/vms/runner-abc12":
+					Expect(json.NewEncoder(w).Encode(orka.OrkaVMResponseModel{Name: "runner-abc12", Metadata: deployed})).To(Succeed())
+				case r.Method == http.MethodGet && r.URL.Path == "/api/v1/namespaces/orka-default/nodes":
+					Expect(json.NewEncoder(w).Encode(orka.OrkaNodeListResponseModel{})).To(Succeed())
+				default:
+					_, _ = w.Write([]byte("{}"))
+				}
+			}))
+			DeferCleanup(server.Close)
+
+			setenv(env.GitHubURLEnvName, "https://github.com/org")
+			setenv(env.GitHubPATEnvName, "token")
+			setenv(env.GitHubRunnerVersionEnvName, "2.321.0")
+			setenv(env.OrkaURLEnvName, server.URL)
+			setenv(env.OrkaTokenEnvName, "token")
+			setenv(env.OrkaVMConfigEnvName, "sonoma")
+			setenv(env.OrkaVMMetadataEnvName, "team=ios,ssh-host-key="+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))))
+			setenv(env.OrkaVMHostKeyFromMetadataEnvName, "true")
+			setenv(env.RunnersEnvName, `[{"name":"runner"}]`)
+
+			envData := env.ParseEnv()
+			orkaClient, err := orka.NewOrkaClient(envData, ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			provisioner = NewRunnerProvisioner(&types.RunnerScaleSet{Id: 1, Name: "runner"}, &envData.Runners[0], mockActions, orkaClient, nil, nil, nil, envData)
+			executor, err := provisioner.deployVM(ctx, "sonoma", "", 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(executor.HostKeyCallback("10.0.0.1:8822", nil, publicKey)).To(Succeed())
+			Expect(executor.HostKeyCallback("10.0.0.1:8822", nil, otherPublicKey)).To(MatchError(orka.ErrHostKeyMismatch))
+		})
+	})
 })
@@ -0,0 +1,112 @@
+package provisioner
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+// RunnerLimiter caps the number of runners that exist at the same time. A limiter can have a parent, for example, a
+// scale set limiter with the global limiter as parent, and a slot is only handed out when both have one free.
+type RunnerLimiter struct {
+	max    int
+	parent *RunnerLimiter
+
+	mu      sync.Mutex
+	inUse   int
+	waiting int
+	freed   chan struct{}
+}
+
+// NewRunnerLimiter creates a limiter for max runners. Zero means no limit.
+func NewRunnerLimiter(max int, parent *RunnerLimiter) *RunnerLimiter {
+	return &RunnerLimiter{
+		max:    max,
+		parent: parent,
+		freed:  make(chan struct{}),
+	}
+}
+
+// Acquire blocks until a slot is free in this limiter and all of its parents.
+func (l *RunnerLimiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	if err := l.acquire(ctx); err != nil {
+		return err
+	}
+
+	if err := l.parent.Acquire(ctx); err != nil {
+		l.release()
+		return err
+	}
+
+	return nil
+}
+
+// Release frees a slot taken by Acquire.
+func (l *RunnerLimiter) Release() {
+	if l == nil {
+		return
+	}
+
+	l.release()
+	l.parent.Release()
+}
+
+// Available returns how many more runners can be started without waiting. Runners that are already waiting for a
+// slot are counted as started.
+func (l *RunnerLimiter) Available() int {
+	if l == nil {
+		return math.MaxInt
+	}
+
+	l.mu.Lock()
+	available := math.MaxInt
+	if l.max > 0 {
+		available = max(l.max-l.inUse-l.waiting, 0)
+	}
+	l.mu.Unlock()
+
+	return min(available, l.parent.Available())
+}
+
+func (l *RunnerLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	l.waiting++
+	defer func() {
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	for l.max > 0 && l.inUse >= l.max {
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			return ctx.Err()
+		case <-freed:
+		}
+
+		l.mu.Lock()
+	}
+
+	l.inUse++
+
+	return nil
+}
+
+func (l *RunnerLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inUse > 0 {
+		l.inUse--
+	}
+
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
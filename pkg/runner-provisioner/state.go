@@ -0,0 +1,181 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/github/types"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
+	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+	"github.com/macstadium/orka-github-actions-integration/pkg/state"
+)
+
+// RecoverRunners reconciles the VMs recorded by a previous process of this scale set against Orka and GitHub.
+// VMs whose runner may still be running a job are returned so that they can be adopted. The runners of all other VMs
+// usually died with the previous process, so they are removed from GitHub and their VMs are deleted.
+func (p *RunnerProvisioner) RecoverRunners(ctx context.Context) []string {
+	if p.stateStore == nil {
+		return nil
+	}
+	p.updateOwnedVMs()
+
+	records, err := p.stateStore.List()
+	if err != nil {
+		p.logger.Errorf("unable to read the state store, skipping recovery: %v", err)
+		return nil
+	}
+
+	busyRunners := []string{}
+	for _, record := range records {
+		if record.ScaleSetName != p.runnerScaleSet.Name {
+			continue
+		}
+
+		_, err := p.orkaClient.GetVM(ctx, record.Namespace, record.RunnerName)
+		if errors.Is(err, orka.ErrVMNotFound) {
+			p.logger.Infof("recorded VM %s no longer exists, removing the runner", record.RunnerName)
+			if err := p.forceDeleteRunner(ctx, record.RunnerName); err == nil {
+				p.deleteState(record.RunnerName)
+			}
+			continue
+		}
+		if err != nil {
+			p.logger.Warnf("unable to check recorded VM %s, keeping it for the next start: %v", record.RunnerName, err)
+			continue
+		}
+
+		runner, err := p.actionsClient.GetRunner(ctx, record.RunnerName)
+		if err != nil {
+			p.logger.Warnf("unable to check runner %s, keeping it for the next start: %v", record.RunnerName, err)
+			continue
+		}
+
+		if mayRunJob(runner) {
+			p.logger.Infof("runner %s is still running %s, adopting VM", record.RunnerName, recordJob(record))
+			busyRunners = append(busyRunners, record.RunnerName)
+			continue
+		}
+
+		p.logger.Infof("recorded VM %s in phase %s is not running a job, cleaning it up", record.RunnerName, record.Phase)
+		go p.discardRunner(context.WithoutCancel(ctx), record.RunnerName)
+	}
+
+	return busyRunners
+}
+
+// discardRunner removes the runner of a previous process from GitHub and deletes its VM. Unlike CleanupResources, it
+// does not wait for the runner to de-register, because its process is gone, and it deletes the VM even when the runner
+// cannot be removed, for example, because GitHub still considers it busy with the job that was interrupted.
+func (p *RunnerProvisioner) discardRunner(ctx context.Context, runnerName string) {
+	if err := p.forceDeleteRunner(ctx, runnerName); err != nil {
+		p.logger.Warnf("unable to remove runner %s from GitHub, deleting its VM anyway: %v", runnerName, err)
+	}
+
+	p.deleteVM(ctx, runnerName)
+}
+
+// mayRunJob reports whether the runner may still be running a job. Only a runner that GitHub reports as idle or offline
+// is known not to, so a runner is adopted when GitHub does not return its busy state or status.
+func mayRunJob(runner *types.RunnerReference) bool {
+	if runner == nil {
+		return false
+	}
+
+	if runner.Busy != nil && !*runner.Busy {
+		return false
+	}
+
+	return runner.Status == "" || runner.Status == types.RunnerStatusOnline
+}
+
+func recordJob(record *state.Record) string {
+	if record.JobId == "" {
+		return "a job"
+	}
+
+	return "job " + record.JobId
+}
+
+func (p *RunnerProvisioner) markRunning(runnerName string, jitConfig *types.RunnerScaleSetJitRunnerConfig, jobId string, runnerRequestId int64) {
+	p.updateState(runnerName, func(record *state.Record) {
+		record.Phase = state.PhaseRunning
+		record.JobId = jobId
+		record.RunnerRequestId = runnerRequestId
+		if jitConfig.Runner != nil {
+			record.RunnerId = jitConfig.Runner.Id
+		}
+	})
+}
+
+// runnerRequestId returns the runner request the VM was recorded for, or zero if it is not known.
+func (p *RunnerProvisioner) runnerRequestId(runnerName string) int64 {
+	if p.stateStore == nil {
+		return 0
+	}
+
+	record, err := p.stateStore.Get(runnerName)
+	if err != nil || record == nil {
+		return 0
+	}
+
+	return record.RunnerRequestId
+}
+
+func (p *RunnerProvisioner) saveState(record *state.Record) {
+	if p.stateStore == nil {
+		return
+	}
+
+	if err := p.stateStore.Put(record); err != nil {
+		p.logger.Warnf("unable to save state of %s: %v", record.RunnerName, err)
+	}
+	p.updateOwnedVMs()
+}
+
+func (p *RunnerProvisioner) updateState(runnerName string, update func(record *state.Record)) {
+	if p.stateStore == nil {
+		return
+	}
+
+	record, err := p.stateStore.Get(runnerName)
+	if err != nil {
+		p.logger.Warnf("unable to read state of %s: %v", runnerName, err)
+		return
+	}
+	if record == nil {
+		return
+	}
+
+	update(record)
+	record.UpdatedAt = time.Now()
+	p.saveState(record)
+}
+
+func (p *RunnerProvisioner) deleteState(runnerName string) {
+	if p.stateStore == nil {
+		return
+	}
+
+	if err := p.stateStore.Delete(runnerName); err != nil {
+		p.logger.Warnf("unable to delete state of %s: %v", runnerName, err)
+	}
+	p.updateOwnedVMs()
+}
+
+// updateOwnedVMs sets the owned VMs metric to the number of VMs of the scale set in the state store.
+func (p *RunnerProvisioner) updateOwnedVMs() {
+	records, err := p.stateStore.List()
+	if err != nil {
+		return
+	}
+
+	owned := 0
+	for _, record := range records {
+		if record.ScaleSetName == p.runnerScaleSet.Name {
+			owned++
+		}
+	}
+
+	metrics.OwnedVMs.WithLabelValues(p.runnerScaleSet.Name).Set(float64(owned))
+}
@@ -0,0 +1,225 @@
+package provisioner
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/macstadium/orka-github-actions-integration/pkg/env"
+	"github.com/macstadium/orka-github-actions-integration/pkg/metrics"
+	"github.com/macstadium/orka-github-actions-integration/pkg/orka"
+	"github.com/macstadium/orka-github-actions-integration/pkg/state"
+	"go.uber.org/zap"
+)
+
+const warmPoolCheckInterval = 30 * time.Second
+
+type warmVM struct {
+	executor *orka.VMCommandExecutor
+	readyAt  time.Time
+}
+
+// WarmPool keeps VMs deployed, reachable over SSH and with the runner already
+// downloaded, so that a job only has to start the runner.
+//
+// The pool aims to keep `target` VMs ready. The target starts at the configured
+// minimum, grows by one each time a job finds the pool empty, up to the maximum,
+// and shrinks by one each time an idle VM is recycled, down to the minimum.
+type WarmPool struct {
+	provisioner *RunnerProvisioner
+	config      *env.WarmPool
+	logger      *zap.SugaredLogger
+
+	mu      sync.Mutex
+	ready   []*warmVM
+	warming int
+	target  int
+	closed  bool
+	// stopped is closed when Start returns. It is nil until Start is called.
+	stopped chan struct{}
+
+	refill chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newWarmPool(provisioner *RunnerProvisioner, config *env.WarmPool) *WarmPool {
+	return &WarmPool{
+		provisioner: provisioner,
+		config:      config,
+		logger:      provisioner.logger.Named("warm-pool"),
+		target:      config.MinSize,
+		refill:      make(chan struct{}, 1),
+	}
+}
+
+// Start keeps the pool filled until the context is canceled. It returns right away when the pool is already closed.
+func (pool *WarmPool) Start(ctx context.Context) {
+	pool.mu.Lock()
+	if pool.closed {
+		pool.mu.Unlock()
+		return
+	}
+	stopped := make(chan struct{})
+	pool.stopped = stopped
+	pool.mu.Unlock()
+	defer close(stopped)
+
+	pool.logger.Infof("starting warm pool with min %d, max %d and max idle age %v", pool.config.MinSize, pool.config.MaxSize, pool.config.MaxIdleAgeDuration)
+
+	ticker := time.NewTicker(warmPoolCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		pool.recycleIdleVMs(ctx)
+		pool.fill(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-pool.refill:
+		}
+	}
+}
+
+// Take removes the VM that has been ready the longest from the pool. It returns nil when the pool is empty.
+func (pool *WarmPool) Take() *warmVM {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	defer pool.requestRefill()
+
+	if len(pool.ready) == 0 {
+		if pool.target < pool.config.MaxSize {
+			pool.target++
+			pool.logger.Infof("warm pool was empty, increasing target size to %d", pool.target)
+		}
+		return nil
+	}
+
+	vm := pool.ready[0]
+	pool.ready = pool.ready[1:]
+
+	return vm
+}
+
+// Close waits for Start to return and for the VMs that are being prepared, and deletes all idle VMs. The context
+// passed to Start must be canceled before, otherwise Close blocks.
+func (pool *WarmPool) Close(ctx context.Context) {
+	pool.mu.Lock()
+	pool.closed = true
+	stopped := pool.stopped
+	pool.mu.Unlock()
+
+	if stopped != nil {
+		<-stopped
+	}
+	pool.wg.Wait()
+
+	pool.mu.Lock()
+	vms := pool.ready
+	pool.ready = nil
+	pool.mu.Unlock()
+
+	for _, vm := range vms {
+		pool.logger.Infof("deleting idle warm pool VM %s", vm.executor.VMName)
+		pool.provisioner.deleteVM(ctx, vm.executor.VMName)
+	}
+}
+
+func (pool *WarmPool) requestRefill() {
+	select {
+	case pool.refill <- struct{}{}:
+	default:
+	}
+}
+
+func (pool *WarmPool) fill(ctx context.Context) {
+	pool.mu.Lock()
+	missing := pool.target - len(pool.ready) - pool.warming
+	if missing <= 0 {
+		pool.mu.Unlock()
+		return
+	}
+	pool.warming += missing
+	pool.mu.Unlock()
+
+	pool.logger.Infof("preparing %d warm pool VMs", missing)
+
+	for i := 0; i < missing; i++ {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			vm := pool.prepareVM(ctx)
+
+			pool.mu.Lock()
+			defer pool.mu.Unlock()
+
+			pool.warming--
+			if vm != nil {
+				pool.ready = append(pool.ready, vm)
+			}
+		}()
+	}
+}
+
+func (pool *WarmPool) prepareVM(ctx context.Context) *warmVM {
+	executor, err := pool.provisioner.deployVM(ctx, pool.provisioner.runner.OrkaVMConfig, "", 0)
+	if err != nil {
+		pool.logger.Warnf("unable to deploy warm pool VM: %v", err)
+		return nil
+	}
+
+	prepare, _ := pool.provisioner.bootstrap()
+	script, err := renderScript(prepare, pool.provisioner.templateData(executor.VMName, executor.VMNode, nil))
+	if err == nil {
+		err = executor.ExecuteCommands(ctx, script)
+	}
+	if err != nil {
+		pool.logger.Warnf("unable to prepare warm pool VM %s, deleting it: %v", executor.VMName, err)
+		pool.provisioner.countFailure(ctx, metrics.FailureReasonWarmPool)
+		pool.provisioner.deleteVM(context.WithoutCancel(ctx), executor.VMName)
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		pool.provisioner.deleteVM(context.WithoutCancel(ctx), executor.VMName)
+		return nil
+	}
+
+	pool.logger.Infof("warm pool VM %s is ready", executor.VMName)
+
+	pool.provisioner.updateState(executor.VMName, func(record *state.Record) {
+		record.Phase = state.PhaseWarm
+	})
+
+	return &warmVM{
+		executor: executor,
+		readyAt:  time.Now(),
+	}
+}
+
+func (pool *WarmPool) recycleIdleVMs(ctx context.Context) {
+	pool.mu.Lock()
+	var expired []*warmVM
+	ready := pool.ready[:0]
+	for _, vm := range pool.ready {
+		if time.Since(vm.readyAt) > pool.config.MaxIdleAgeDuration {
+			expired = append(expired, vm)
+		} else {
+			ready = append(ready, vm)
+		}
+	}
+	pool.ready = ready
+
+	for range expired {
+		if pool.target > pool.config.MinSize {
+			pool.target--
+		}
+	}
+	pool.mu.Unlock()
+
+	for _, vm := range expired {
+		pool.logger.Infof("recycling warm pool VM %s after being idle for %v", vm.executor.VMName, time.Since(vm.readyAt).Round(time.Second))
+		pool.provisioner.deleteVM(context.WithoutCancel(ctx), vm.executor.VMName)
+	}
+}
@@ -0,0 +1,92 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps the records in memory and writes all of them to a JSON file on every change.
+// The file is replaced atomically, so it is never left half written.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state file %s: %w", path, err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.records); err != nil {
+			return nil, fmt.Errorf("unable to parse state file %s: %w", path, err)
+		}
+	}
+
+	return store, nil
+}
+
+func (s *FileStore) Put(record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.RunnerName] = *record
+
+	return s.save()
+}
+
+func (s *FileStore) Delete(runnerName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[runnerName]; !ok {
+		return nil
+	}
+	delete(s.records, runnerName)
+
+	return s.save()
+}
+
+func (s *FileStore) save() error {
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("unable to create state directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to write state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write state file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("unable to write state file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package state
+
+import (
+	"sync"
+)
+
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: map[string]Record{},
+	}
+}
+
+func (s *MemoryStore) Put(record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.RunnerName] = *record
+
+	return nil
+}
+
+func (s *MemoryStore) Get(runnerName string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[runnerName]
+	if !ok {
+		return nil, nil
+	}
+
+	return &record, nil
+}
+
+func (s *MemoryStore) Delete(runnerName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, runnerName)
+
+	return nil
+}
+
+func (s *MemoryStore) List() ([]*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*Record, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, &record)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,51 @@
+package state
+
+import (
+	"time"
+)
+
+type Phase string
+
+const (
+	// PhaseWarm is a VM that is prepared in a warm pool and not yet used by a runner.
+	PhaseWarm Phase = "warm"
+	// PhaseProvisioning is a VM that is deployed and waiting for its runner to be configured.
+	PhaseProvisioning Phase = "provisioning"
+	// PhaseRunning is a VM whose runner has been started.
+	PhaseRunning Phase = "running"
+	// PhaseCleanup is a VM whose runner is being de-registered and deleted.
+	PhaseCleanup Phase = "cleanup"
+)
+
+// Record is the state of a single Orka VM created by a runner scale set. The VM name is also the runner name.
+type Record struct {
+	RunnerName      string    `json:"runnerName"`
+	ScaleSetId      int       `json:"scaleSetId"`
+	ScaleSetName    string    `json:"scaleSetName"`
+	Namespace       string    `json:"namespace"`
+	IP              string    `json:"ip,omitempty"`
+	JobId           string    `json:"jobId,omitempty"`
+	RunnerRequestId int64     `json:"runnerRequestId,omitempty"`
+	RunnerId        int       `json:"runnerId,omitempty"`
+	Phase           Phase     `json:"phase"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// Store keeps the records of the VMs that exist, so that they can be recovered after a restart.
+type Store interface {
+	Put(record *Record) error
+	// Get returns nil when there is no record for the runner.
+	Get(runnerName string) (*Record, error)
+	Delete(runnerName string) error
+	List() ([]*Record, error)
+}
+
+// NewStore returns a store that persists records to the file at path, or an in-memory store when path is empty.
+func NewStore(path string) (Store, error) {
+	if path == "" {
+		return NewMemoryStore(), nil
+	}
+
+	return NewFileStore(path)
+}
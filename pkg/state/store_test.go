@@ -0,0 +1,54 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestState(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "State Suite")
+}
+
+var _ = Describe("Store", func() {
+	record := &Record{
+		RunnerName:      "runner-abc12",
+		ScaleSetId:      1,
+		ScaleSetName:    "runner",
+		Namespace:       "orka-default",
+		JobId:           "job-1",
+		RunnerRequestId: 42,
+		Phase:           PhaseRunning,
+		CreatedAt:       time.Now().UTC().Truncate(time.Second),
+	}
+
+	It("should keep records in memory", func() {
+		store, err := NewStore("")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(store.Put(record)).To(Succeed())
+		Expect(store.Get(record.RunnerName)).To(Equal(record))
+		Expect(store.List()).To(HaveLen(1))
+
+		Expect(store.Delete(record.RunnerName)).To(Succeed())
+		Expect(store.Get(record.RunnerName)).To(BeNil())
+	})
+
+	It("should load the records written by a previous process", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "state", "state.json")
+
+		store, err := NewStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Put(record)).To(Succeed())
+		Expect(store.Put(&Record{RunnerName: "runner-def34", Phase: PhaseWarm})).To(Succeed())
+		Expect(store.Delete("runner-def34")).To(Succeed())
+
+		reopened, err := NewStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reopened.List()).To(ConsistOf(record))
+	})
+})
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The spans of a job are started from different messages, goroutines and even processes of the controller. To put
+// them into one trace anyway, the trace ID and the ID of the root span are derived from the runner request ID. The
+// root span itself is recorded by RecordJob once GitHub reports the job as completed.
+
+type jobRootKey struct{}
+
+// JobContext returns a context in which new spans belong to the trace of the runner request. A runner request ID of
+// zero, which idle runners use, returns ctx unchanged.
+func JobContext(ctx context.Context, runnerRequestId int64) context.Context {
+	if runnerRequestId == 0 {
+		return ctx
+	}
+
+	traceID, rootSpanID := jobIDs(runnerRequestId)
+
+	return trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     rootSpanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}))
+}
+
+// StartJobSpan starts a span in the trace of the runner request.
+func StartJobSpan(ctx context.Context, runnerRequestId int64, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if runnerRequestId != 0 {
+		attributes = append(attributes, RunnerRequestIdKey.Int64(runnerRequestId))
+	}
+
+	return Tracer().Start(JobContext(ctx, runnerRequestId), name, trace.WithAttributes(attributes...))
+}
+
+// RecordJob records the root span of the runner request's trace, from the time the job was queued until it finished.
+func RecordJob(ctx context.Context, runnerRequestId int64, start, end time.Time, attributes ...attribute.KeyValue) {
+	if runnerRequestId == 0 || start.IsZero() || end.IsZero() {
+		return
+	}
+
+	ctx = context.WithValue(ctx, jobRootKey{}, runnerRequestId)
+	attributes = append(attributes, RunnerRequestIdKey.Int64(runnerRequestId))
+
+	_, span := Tracer().Start(ctx, "Job", trace.WithNewRoot(), trace.WithTimestamp(start), trace.WithAttributes(attributes...))
+	span.End(trace.WithTimestamp(end))
+}
+
+func jobIDs(runnerRequestId int64) (trace.TraceID, trace.SpanID) {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("runner-request/%d", runnerRequestId)))
+
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	copy(traceID[:], sum[:16])
+	copy(spanID[:], sum[16:24])
+
+	return traceID, spanID
+}
+
+// idGenerator creates random IDs, except for the root span of a job, which gets the IDs derived from its runner request.
+type idGenerator struct{}
+
+func newIDGenerator() *idGenerator {
+	return &idGenerator{}
+}
+
+func (g *idGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if runnerRequestId, ok := ctx.Value(jobRootKey{}).(int64); ok {
+		return jobIDs(runnerRequestId)
+	}
+
+	var traceID trace.TraceID
+	_, _ = rand.Read(traceID[:])
+
+	return traceID, g.NewSpanID(ctx, traceID)
+}
+
+func (g *idGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+
+	return spanID
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName         = "github.com/macstadium/orka-github-actions-integration"
+	defaultServiceName = "orka-github-runner"
+)
+
+// Span attributes that identify a job.
+const (
+	RunnerRequestIdKey = attribute.Key("github.runner_request_id")
+	JobIdKey           = attribute.Key("github.job_id")
+	JobResultKey       = attribute.Key("github.job_result")
+	RunnerNameKey      = attribute.Key("github.runner_name")
+	ScaleSetKey        = attribute.Key("github.runner_scale_set")
+)
+
+// Tracer returns the tracer for the spans of the controller. Spans are not recorded until Setup has been called.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Setup installs a tracer provider that exports spans to an OTLP endpoint over HTTP. The endpoint and headers are
+// configured with the standard OTEL_EXPORTER_OTLP_* env variables. The returned function flushes the remaining spans
+// and stops the provider.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the OTLP trace exporter: %w", err)
+	}
+
+	return install(sdktrace.WithBatcher(exporter))
+}
+
+// SetupWithExporter installs a tracer provider that hands every span to the exporter as soon as it ends, for example,
+// to an in-memory exporter from the tracetest package when testing locally.
+func SetupWithExporter(exporter sdktrace.SpanExporter) (func(context.Context) error, error) {
+	return install(sdktrace.WithSyncer(exporter))
+}
+
+func install(options ...sdktrace.TracerProviderOption) (func(context.Context) error, error) {
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(defaultServiceName)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithIDGenerator(newIDGenerator()),
+	}, options...)...)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
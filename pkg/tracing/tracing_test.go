@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tracing Suite")
+}
+
+var _ = Describe("Job traces", func() {
+	var (
+		exporter *tracetest.InMemoryExporter
+		shutdown func(context.Context) error
+	)
+
+	BeforeEach(func() {
+		exporter = tracetest.NewInMemoryExporter()
+
+		var err error
+		shutdown, err = SetupWithExporter(exporter)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(shutdown(context.Background())).To(Succeed())
+	})
+
+	It("should put all spans of a runner request into one trace under the job span", func() {
+		_, acquire := StartJobSpan(context.Background(), 42, "AcquireJobs")
+		acquire.End()
+
+		ctx, provision := StartJobSpan(context.Background(), 42, "ProvisionRunner")
+		_, deploy := Tracer().Start(ctx, "DeployVM")
+		deploy.End()
+		provision.End()
+
+		RecordJob(context.Background(), 42, time.Now().Add(-time.Minute), time.Now())
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(4))
+
+		root := spans[3]
+		Expect(root.Name).To(Equal("Job"))
+		Expect(root.Parent.IsValid()).To(BeFalse())
+
+		for _, span := range spans {
+			Expect(span.SpanContext.TraceID()).To(Equal(root.SpanContext.TraceID()))
+		}
+		Expect(spans[0].Parent.SpanID()).To(Equal(root.SpanContext.SpanID()))
+		Expect(spans[2].Parent.SpanID()).To(Equal(root.SpanContext.SpanID()))
+		Expect(spans[1].Parent.SpanID()).To(Equal(spans[2].SpanContext.SpanID()))
+	})
+
+	It("should use separate traces for separate runner requests", func() {
+		_, first := StartJobSpan(context.Background(), 1, "JobAssigned")
+		first.End()
+		_, second := StartJobSpan(context.Background(), 2, "JobAssigned")
+		second.End()
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].SpanContext.TraceID()).NotTo(Equal(spans[1].SpanContext.TraceID()))
+	})
+
+	It("should start a new trace for idle runners", func() {
+		_, span := StartJobSpan(context.Background(), 0, "ProvisionRunner")
+		span.End()
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Parent.IsValid()).To(BeFalse())
+	})
+})
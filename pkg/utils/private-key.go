@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	// ErrPassphraseRequired is returned for encrypted private keys when no passphrase is configured.
+	ErrPassphraseRequired = errors.New("the private key is encrypted and requires a passphrase")
+	// ErrIncorrectPassphrase is returned when an encrypted private key cannot be decrypted with the passphrase.
+	ErrIncorrectPassphrase = errors.New("unable to decrypt the private key with the passphrase")
+)
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// ParseRSAPrivateKey parses a PEM encoded RSA private key in the PKCS#1 or the PKCS#8 format. Encrypted keys are
+// decrypted with the passphrase, which supports the legacy encrypted PEM blocks and PKCS#8 keys encrypted with PBES2
+// and AES, as created by `openssl genpkey -aes256`.
+func ParseRSAPrivateKey(data []byte, passphrase string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+
+	der := block.Bytes
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+
+		var err error
+		if der, err = decryptPKCS8(block.Bytes, []byte(passphrase)); err != nil {
+			return nil, err
+		}
+
+	// Legacy encrypted PEM blocks are insecure and deprecated, but still created by older OpenSSL versions
+	case x509.IsEncryptedPEMBlock(block):
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+
+		var err error
+		if der, err = x509.DecryptPEMBlock(block, []byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrIncorrectPassphrase, err)
+		}
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		if block.Type == "ENCRYPTED PRIVATE KEY" {
+			return nil, ErrIncorrectPassphrase
+		}
+		return nil, fmt.Errorf("unable to parse the private key as PKCS#1 or PKCS#8: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("the private key is a %T, not an RSA key", key)
+	}
+
+	return rsaKey, nil
+}
+
+// decryptPKCS8 decrypts a PBES2 encrypted PKCS#8 private key and returns the unencrypted PKCS#8 DER.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("unable to parse the encrypted private key: %w", err)
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %s, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("unable to parse the PBES2 parameters: %w", err)
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s, only PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, fmt.Errorf("unable to parse the PBKDF2 parameters: %w", err)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdfParams.PRF.Algorithm) == 0, kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %s", kdfParams.PRF.Algorithm)
+	}
+
+	var keyLength int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLength = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLength = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, fmt.Errorf("unsupported private key cipher %s, only AES-CBC is supported", params.EncryptionScheme.Algorithm)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("unable to parse the cipher parameters: %w", err)
+	}
+
+	if len(iv) != aes.BlockSize || len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("the encrypted private key is malformed")
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, kdfParams.Salt, kdfParams.IterationCount, keyLength, prf))
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+
+	// A wrong passphrase almost always results in an invalid PKCS#7 padding
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, ErrIncorrectPassphrase
+	}
+	for _, b := range decrypted[len(decrypted)-padding:] {
+		if int(b) != padding {
+			return nil, ErrIncorrectPassphrase
+		}
+	}
+
+	return decrypted[:len(decrypted)-padding], nil
+}